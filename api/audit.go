@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditLogEnv names the environment variable with the path of the audit log.
+// If it is empty, audit entries go to the regular log.
+const auditLogEnv = "AUDIT_LOG"
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	RuntimeId string    `json:"runtimeId,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Command   []string  `json:"command,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	Stream    string    `json:"stream,omitempty"`
+	Data      string    `json:"data,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	auditMu   sync.Mutex
+	auditFile *os.File
+)
+
+// audit appends an entry to the audit log
+func audit(entry auditEntry) {
+	entry.Time = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	path := os.Getenv(auditLogEnv)
+	if len(path) == 0 {
+		log.Println("AUDIT", string(line))
+		return
+	}
+
+	if auditFile == nil {
+		auditFile, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Println("Could not open audit log:", err)
+			log.Println("AUDIT", string(line))
+			return
+		}
+	}
+
+	auditFile.Write(append(line, '\n'))
+}
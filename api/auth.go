@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// supportTokensEnv names the environment variable listing who may use the
+// support endpoints (exec, port-forward), as comma separated name:token pairs.
+// If it is empty, those endpoints refuse every request.
+const supportTokensEnv = "SUPPORT_TOKENS"
+
+// authenticatedHandler is a handler that knows who is calling it
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, user string)
+
+// requestToken returns the bearer token of a request. Tokens are only taken
+// from the Authorization header, never the query string, which ends up in
+// access logs and browser history.
+func requestToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// authenticate returns the name the token of the request was issued to
+func authenticate(r *http.Request, tokensEnv string) (string, bool) {
+	token := requestToken(r)
+	if len(token) == 0 {
+		return "", false
+	}
+
+	for _, entry := range strings.Split(os.Getenv(tokensEnv), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) == 1 {
+			return parts[0], true
+		}
+	}
+
+	return "", false
+}
+
+// withSupportAuth only lets requests with a token from SUPPORT_TOKENS through
+func withSupportAuth(next authenticatedHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(r, supportTokensEnv)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r, user)
+	})
+}
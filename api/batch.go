@@ -0,0 +1,34 @@
+package api
+
+import "sync"
+
+// runForEach calls fn for every runtime ID, either one after the other or
+// all at once, and returns the error (or nil) that each call ended with
+func runForEach(runtimeIds []string, concurrent bool, fn func(runtimeId string) error) map[string]error {
+	result := make(map[string]error, len(runtimeIds))
+
+	if !concurrent {
+		for _, runtimeId := range runtimeIds {
+			result[runtimeId] = fn(runtimeId)
+		}
+		return result
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, rId := range runtimeIds {
+		runtimeId := rId
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := fn(runtimeId)
+
+			mu.Lock()
+			result[runtimeId] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return result
+}
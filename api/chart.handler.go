@@ -19,6 +19,18 @@ func InstallChartHandler() http.Handler {
 		}
 
 		createErr := ir.Execute()
+		if qerr, ok := createErr.(*client.QuotaExceededError); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(client.ErrorResponse{Error: qerr.Error()})
+			return
+		}
+		if lerr, ok := createErr.(*client.LockBusyError); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(client.ErrorResponse{Error: lerr.Error()})
+			return
+		}
 		if createErr != nil {
 			log.Println(createErr)
 			w.WriteHeader(http.StatusInternalServerError)
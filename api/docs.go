@@ -0,0 +1,132 @@
+package api
+
+// docsPage renders /openapi.json: operations grouped by tag, with their
+// parameters, request bodies and responses
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>helmAPI</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0 auto; max-width: 960px; padding: 24px; color: #1f2328; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: 4px; margin-top: 32px; text-transform: capitalize; }
+details { border: 1px solid #d0d7de; border-radius: 6px; margin: 8px 0; }
+summary { cursor: pointer; padding: 8px; font-family: monospace; font-size: 14px; }
+.method { display: inline-block; width: 64px; font-weight: bold; text-transform: uppercase; }
+.get { color: #0969da; } .post { color: #1a7f37; } .put { color: #9a6700; } .delete { color: #cf222e; }
+.body { padding: 0 16px 12px; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+td, th { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eaeef2; vertical-align: top; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; font-size: 13px; }
+.muted { color: #656d76; }
+</style>
+</head>
+<body>
+<h1 id="title">helmAPI</h1>
+<p id="description" class="muted"></p>
+<p><a href="openapi.json">openapi.json</a></p>
+<div id="operations"></div>
+<script>
+(function () {
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) { node.setAttribute(key, attrs[key]); });
+    (children || []).forEach(function (child) {
+      node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+    });
+    return node;
+  }
+
+  function render(spec) {
+    var schemas = spec.components.schemas;
+
+    function resolve(schema) {
+      while (schema && schema.$ref) {
+        schema = schemas[schema.$ref.replace("#/components/schemas/", "")];
+      }
+      return schema || {};
+    }
+
+    function describe(schema, depth) {
+      schema = resolve(schema);
+      if (depth > 4) { return "..."; }
+      if (schema.type === "object" && schema.properties) {
+        var out = {};
+        Object.keys(schema.properties).sort().forEach(function (key) {
+          var required = (schema.required || []).indexOf(key) >= 0;
+          out[key + (required ? "" : "?")] = describe(schema.properties[key], depth + 1);
+        });
+        return out;
+      }
+      if (schema.type === "array") { return [describe(schema.items, depth + 1)]; }
+      var text = schema.type || "any";
+      if (schema.format) { text += " (" + schema.format + ")"; }
+      if (schema.enum) { text += " " + schema.enum.map(function (v) { return JSON.stringify(v); }).join(" | "); }
+      if (schema.pattern) { text += " matching " + schema.pattern; }
+      if (schema.maxLength) { text += ", at most " + schema.maxLength + " characters"; }
+      if (schema.description) { text += " - " + schema.description; }
+      return text;
+    }
+
+    document.getElementById("title").textContent = spec.info.title + " v" + spec.info.version;
+    document.getElementById("description").textContent = spec.info.description || "";
+
+    var tags = {};
+    Object.keys(spec.paths).sort().forEach(function (path) {
+      Object.keys(spec.paths[path]).sort().forEach(function (method) {
+        var op = spec.paths[path][method];
+        var tag = (op.tags || ["other"])[0];
+        (tags[tag] = tags[tag] || []).push({ path: path, method: method, op: op });
+      });
+    });
+
+    var root = document.getElementById("operations");
+    Object.keys(tags).sort().forEach(function (tag) {
+      root.appendChild(el("h2", {}, [tag]));
+      tags[tag].forEach(function (entry) {
+        var op = entry.op;
+        var body = el("div", { "class": "body" }, [el("p", {}, [op.summary])]);
+
+        if (op.parameters && op.parameters.length) {
+          var rows = op.parameters.map(function (p) {
+            return el("tr", {}, [
+              el("td", {}, [el("code", {}, [p.name]), p.required ? " *" : ""]),
+              el("td", { "class": "muted" }, [p.in]),
+              el("td", {}, [JSON.stringify(describe(p.schema, 0)).replace(/^"|"$/g, "")])
+            ]);
+          });
+          body.appendChild(el("h4", {}, ["Parameters"]));
+          body.appendChild(el("table", {}, rows));
+        }
+
+        if (op.requestBody) {
+          var schema = op.requestBody.content["application/json"].schema;
+          body.appendChild(el("h4", {}, ["Body"]));
+          body.appendChild(el("pre", {}, [JSON.stringify(describe(schema, 0), null, 2)]));
+        }
+
+        var responses = Object.keys(op.responses).sort().map(function (code) {
+          return el("tr", {}, [el("td", {}, [el("code", {}, [code])]), el("td", {}, [op.responses[code].description])]);
+        });
+        body.appendChild(el("h4", {}, ["Responses"]));
+        body.appendChild(el("table", {}, responses));
+
+        root.appendChild(el("details", {}, [
+          el("summary", {}, [el("span", { "class": "method " + entry.method }, [entry.method]), entry.path]),
+          body
+        ]));
+      });
+    });
+  }
+
+  fetch("openapi.json")
+    .then(function (res) { return res.json(); })
+    .then(render)
+    .catch(function (err) {
+      document.getElementById("operations").textContent = "Could not load openapi.json: " + err;
+    });
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// execAllowedCommandsEnv lists the commands that may be run through
+	// /runtime/exec, comma separated. Each is a full command line, arguments
+	// separated by spaces, and must match the requested argv exactly. Empty
+	// allows nothing.
+	execAllowedCommandsEnv = "EXEC_ALLOWED_COMMANDS"
+	// portForwardAllowedPortsEnv lists the ports that may be forwarded
+	// through /runtime/port-forward, comma separated. Empty allows all.
+	portForwardAllowedPortsEnv = "PORT_FORWARD_ALLOWED_PORTS"
+	// supportIdleTimeoutEnv is how long an exec or port-forward session can
+	// go without traffic before it is closed, e.g. "10m"
+	supportIdleTimeoutEnv = "SUPPORT_IDLE_TIMEOUT"
+)
+
+// Channels of the exec protocol. Every WebSocket message starts with the
+// channel byte, like the channel.k8s.io protocol of the API server.
+const (
+	stdinChannel  byte = 0
+	stdoutChannel byte = 1
+	stderrChannel byte = 2
+	errorChannel  byte = 3
+	resizeChannel byte = 4
+)
+
+func newSessionId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func idleTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(supportIdleTimeoutEnv)); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+func isCommandAllowed(command []string) bool {
+	if len(command) == 0 {
+		return false
+	}
+
+	for _, entry := range strings.Split(os.Getenv(execAllowedCommandsEnv), ",") {
+		argv := strings.Fields(entry)
+		if len(argv) != len(command) {
+			continue
+		}
+
+		matches := true
+		for i := range argv {
+			if argv[i] != command[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func isPortAllowed(port int) bool {
+	allowed := os.Getenv(portForwardAllowedPortsEnv)
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, p := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(p) == strconv.Itoa(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// idleTracker closes a session once it has seen no traffic for a while
+type idleTracker struct {
+	mu       sync.Mutex
+	last     time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newIdleTracker(timeout time.Duration, onIdle func()) *idleTracker {
+	t := &idleTracker{last: time.Now(), done: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(timeout / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+
+			t.mu.Lock()
+			idle := time.Since(t.last) > timeout
+			t.mu.Unlock()
+			if idle {
+				onIdle()
+				return
+			}
+		}
+	}()
+
+	return t
+}
+
+func (t *idleTracker) touch() {
+	t.mu.Lock()
+	t.last = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *idleTracker) stop() {
+	t.stopOnce.Do(func() { close(t.done) })
+}
+
+// channelWriter sends what is written to it on one channel of the
+// WebSocket, recording it in the audit log
+type channelWriter struct {
+	ws      *websocket.Conn
+	mu      *sync.Mutex
+	channel byte
+	stream  string
+	idle    *idleTracker
+	entry   auditEntry
+}
+
+func (cw *channelWriter) Write(p []byte) (int, error) {
+	cw.idle.touch()
+
+	entry := cw.entry
+	entry.Action = "exec.output"
+	entry.Stream = cw.stream
+	entry.Data = string(p)
+	audit(entry)
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	err := websocket.Message.Send(cw.ws, append([]byte{cw.channel}, p...))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// resolveTargetPod returns ?pod= if it is a runtime pod in ?namespace=,
+// otherwise the pod of ?runtimeId=
+func resolveTargetPod(r *http.Request) (string, error) {
+	query := r.URL.Query()
+	return k8s.RuntimePod(r.Context(), query.Get("namespace"), query.Get("runtimeId"), query.Get("pod"))
+}
+
+// ExecRuntimeHandler serves WebSocket requests at /runtime/exec. The pod is
+// picked by ?runtimeId= or ?pod=, the command is given as repeated ?command=
+// and must be one of EXEC_ALLOWED_COMMANDS, arguments included. Messages are
+// prefixed with a channel byte: 0 stdin, 1 stdout, 2 stderr, 3 error,
+// 4 resize ({"Width","Height"}).
+func ExecRuntimeHandler() http.Handler {
+	return withSupportAuth(func(w http.ResponseWriter, r *http.Request, user string) {
+		query := r.URL.Query()
+		command := query["command"]
+		tty := query.Get("tty") == "true"
+
+		if !isCommandAllowed(command) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		pod, err := resolveTargetPod(r)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		entry := auditEntry{
+			Session:   newSessionId(),
+			User:      user,
+			RuntimeId: query.Get("runtimeId"),
+			Pod:       pod,
+			Container: query.Get("container"),
+			Command:   command,
+		}
+
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ws.PayloadType = websocket.BinaryFrame
+
+			start := entry
+			start.Action = "exec.start"
+			audit(start)
+
+			stdin, stdinWriter := io.Pipe()
+			resize := make(chan k8s.TerminalSize, 1)
+			idle := newIdleTracker(idleTimeout(), func() {
+				log.Println("Closing idle exec session", entry.Session)
+				stdinWriter.Close()
+				ws.Close()
+			})
+			defer idle.stop()
+
+			go func() {
+				defer stdinWriter.Close()
+				defer close(resize)
+				for {
+					var msg []byte
+					if err := websocket.Message.Receive(ws, &msg); err != nil {
+						return
+					}
+					if len(msg) == 0 {
+						continue
+					}
+					idle.touch()
+
+					switch msg[0] {
+					case stdinChannel:
+						input := entry
+						input.Action = "exec.input"
+						input.Stream = "stdin"
+						input.Data = string(msg[1:])
+						audit(input)
+						stdinWriter.Write(msg[1:])
+					case resizeChannel:
+						var size k8s.TerminalSize
+						if json.Unmarshal(msg[1:], &size) == nil {
+							select {
+							case resize <- size:
+							default:
+							}
+						}
+					}
+				}
+			}()
+
+			var sendMu sync.Mutex
+			err := k8s.ExecInPod(k8s.ExecOptions{
+				Namespace: query.Get("namespace"),
+				Pod:       pod,
+				Container: entry.Container,
+				Command:   command,
+				TTY:       tty,
+				Stdin:     stdin,
+				Stdout:    &channelWriter{ws: ws, mu: &sendMu, channel: stdoutChannel, stream: "stdout", idle: idle, entry: entry},
+				Stderr:    &channelWriter{ws: ws, mu: &sendMu, channel: stderrChannel, stream: "stderr", idle: idle, entry: entry},
+				Resize:    resize,
+			})
+
+			end := entry
+			end.Action = "exec.end"
+			if err != nil {
+				end.Error = err.Error()
+				sendMu.Lock()
+				websocket.Message.Send(ws, append([]byte{errorChannel}, err.Error()...))
+				sendMu.Unlock()
+			}
+			audit(end)
+		}}.ServeHTTP(w, r)
+	})
+}
+
+// PortForwardRuntimeHandler serves WebSocket requests at /runtime/port-forward.
+// The pod is picked by ?runtimeId= or ?pod=, and ?port= must be in
+// PORT_FORWARD_ALLOWED_PORTS if that is set. Binary messages carry the raw
+// bytes of the connection in both directions.
+func PortForwardRuntimeHandler() http.Handler {
+	return withSupportAuth(func(w http.ResponseWriter, r *http.Request, user string) {
+		query := r.URL.Query()
+		port, err := strconv.Atoi(query.Get("port"))
+		if err != nil || port <= 0 || port > 65535 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !isPortAllowed(port) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		pod, err := resolveTargetPod(r)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		entry := auditEntry{
+			Session:   newSessionId(),
+			User:      user,
+			RuntimeId: query.Get("runtimeId"),
+			Pod:       pod,
+			Port:      port,
+		}
+
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ws.PayloadType = websocket.BinaryFrame
+
+			// Dial once the handshake is done, so that a failed upgrade
+			// does not leave a connection to the pod behind
+			conn, err := k8s.DialPod(query.Get("namespace"), pod, port)
+			if err != nil {
+				log.Println(err)
+				end := entry
+				end.Action = "port-forward.end"
+				end.Error = err.Error()
+				audit(end)
+				return
+			}
+			defer conn.Close()
+
+			start := entry
+			start.Action = "port-forward.start"
+			audit(start)
+
+			idle := newIdleTracker(idleTimeout(), func() {
+				log.Println("Closing idle port-forward session", entry.Session)
+				conn.Close()
+				ws.Close()
+			})
+			defer idle.stop()
+
+			var sent, received int64
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				buf := make([]byte, 32*1024)
+				for {
+					n, err := conn.Read(buf)
+					if n > 0 {
+						idle.touch()
+						received += int64(n)
+						if websocket.Message.Send(ws, buf[:n]) != nil {
+							return
+						}
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+
+			for {
+				var msg []byte
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					break
+				}
+				idle.touch()
+				sent += int64(len(msg))
+				if _, err := conn.Write(msg); err != nil {
+					break
+				}
+			}
+			conn.Close()
+			<-done
+
+			end := entry
+			end.Action = "port-forward.end"
+			end.Bytes = sent + received
+			audit(end)
+		}}.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+const (
+	// idempotencyWindowEnv is how long the response to an Idempotency-Key
+	// is replayed for, e.g. "24h"
+	idempotencyWindowEnv = "IDEMPOTENCY_WINDOW"
+	// idempotencyAnnotation holds the recorded response on the lease of a key
+	idempotencyAnnotation = "helmapi.mayahq.com/idempotency"
+	// maxRecordedBodySize is the largest response body kept for a key. The
+	// annotations of a lease may take 256KiB in total, and the body is
+	// stored JSON encoded, which can make it grow.
+	maxRecordedBodySize = 64 * 1024
+)
+
+// recordedResponse is the first response given to an idempotency key
+type recordedResponse struct {
+	RequestHash string    `json:"requestHash"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        string    `json:"body"`
+	RecordedAt  time.Time `json:"recordedAt"`
+	// TooLarge is set instead of Body when the body was over
+	// maxRecordedBodySize
+	TooLarge bool `json:"tooLarge,omitempty"`
+}
+
+func idempotencyWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(idempotencyWindowEnv)); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyLeaseName scopes a key to the endpoint it was sent to
+func idempotencyLeaseName(path string, key string) string {
+	sum := sha256.Sum256([]byte(path + "\n" + key))
+	return "helmapi-idempotency-" + hex.EncodeToString(sum[:16])
+}
+
+// recordedOn returns the response recorded on a lease, if it is still
+// within the window
+func recordedOn(annotations map[string]string) (*recordedResponse, bool) {
+	value, ok := annotations[idempotencyAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	var recorded recordedResponse
+	if err := json.Unmarshal([]byte(value), &recorded); err != nil {
+		return nil, false
+	}
+	if time.Since(recorded.RecordedAt) > idempotencyWindow() {
+		return nil, false
+	}
+	return &recorded, true
+}
+
+// replay answers with a recorded response, or with 422 if the key was
+// first used for a different request or its response could not be kept
+func replay(w http.ResponseWriter, recorded *recordedResponse, requestHash string) {
+	if recorded.RequestHash != requestHash {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if recorded.TooLarge {
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeError(w, http.StatusUnprocessableEntity, fmt.Errorf(
+			"the request already ran with status %d, but its response was too large to be replayed", recorded.Status))
+		return
+	}
+
+	if len(recorded.ContentType) > 0 {
+		w.Header().Set("Content-Type", recorded.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(recorded.Status)
+	w.Write([]byte(recorded.Body))
+}
+
+// recordingWriter passes the response through while keeping a copy of it,
+// up to maxRecordedBodySize
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if rw.body.Len()+len(p) > maxRecordedBodySize {
+		rw.tooLarge = true
+		rw.body.Reset()
+	}
+	if !rw.tooLarge {
+		rw.body.Write(p)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Idempotent makes a mutating handler honour the Idempotency-Key header. The
+// first response to a key is kept on a Lease for IDEMPOTENCY_WINDOW and
+// replayed for requests with the same key and body. The same key with a
+// different body gets 422, and 409 with Retry-After while the first request
+// is running.
+// Server errors are not recorded, so that the request can be retried.
+func Idempotent(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if len(key) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+		requestHash := hex.EncodeToString(sum[:])
+
+		lm, err := k8s.DefaultLeaseManager()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.Background()
+		name := idempotencyLeaseName(r.URL.Path, key)
+		lock, err := lm.Acquire(ctx, name, map[string]string{client.LockLabel: "idempotency"})
+		if _, held := err.(*k8s.ErrLeaseHeld); held {
+			// Retry-After tells clients this conflict goes away on its own
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusConflict, fmt.Errorf("a request with Idempotency-Key %s is in progress", key))
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer func() {
+			if err := lock.Release(ctx); err != nil {
+				log.Println("Could not release idempotency key", err)
+			}
+		}()
+
+		if recorded, ok := recordedOn(lock.Lease().Annotations); ok {
+			replay(w, recorded, requestHash)
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		if rw.status >= 500 {
+			return
+		}
+		if rw.tooLarge {
+			log.Println("Response to idempotency key of", r.URL.Path, "is over", maxRecordedBodySize,
+				"bytes, retries with the key will get 422")
+		}
+		recorded, err := json.Marshal(recordedResponse{
+			RequestHash: requestHash,
+			Status:      rw.status,
+			ContentType: rw.Header().Get("Content-Type"),
+			Body:        rw.body.String(),
+			RecordedAt:  time.Now(),
+			TooLarge:    rw.tooLarge,
+		})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		lock.SetAnnotation(idempotencyAnnotation, string(recorded))
+	})
+}
+
+// ExpireIdempotencyKeys deletes the leases of idempotency keys whose
+// responses have left the window, forever
+func ExpireIdempotencyKeys(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		lm, err := k8s.DefaultLeaseManager()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		ctx := context.Background()
+		leases, err := lm.List(ctx, client.LockLabel+"=idempotency")
+		if err != nil {
+			log.Println("Could not list idempotency keys", err)
+			continue
+		}
+
+		for i := range leases {
+			lease := &leases[i]
+			if !k8s.LeaseExpired(lease) {
+				continue
+			}
+			if _, ok := recordedOn(lease.Annotations); ok {
+				continue
+			}
+			if lock, err := lm.Acquire(ctx, lease.Name, nil); err == nil {
+				lock.Delete(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+// parseLogOptions reads the log options from the query string
+func parseLogOptions(r *http.Request) (k8s.LogOptions, error) {
+	query := r.URL.Query()
+	opts := k8s.LogOptions{
+		Container:  query.Get("container"),
+		Previous:   query.Get("previous") == "true",
+		Follow:     query.Get("follow") == "true",
+		Timestamps: query.Get("timestamps") == "true",
+	}
+
+	if tail := query.Get("tailLines"); len(tail) > 0 {
+		tailLines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || tailLines < 0 {
+			return opts, fmt.Errorf("invalid tailLines %s", tail)
+		}
+		opts.TailLines = &tailLines
+	}
+
+	if since := query.Get("since"); len(since) > 0 {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid since %s", since)
+		}
+		sinceSeconds := int64(d.Seconds())
+		opts.SinceSeconds = &sinceSeconds
+	}
+
+	return opts, nil
+}
+
+// streamLines copies logs to the response line by line, flushing after
+// every line. With sse set, every line is sent as a Server-Sent Event.
+func streamLines(w http.ResponseWriter, logs io.Reader, sse bool) {
+	flusher, _ := w.(http.Flusher)
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var err error
+		if sse {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", scanner.Text())
+		} else {
+			_, err = fmt.Fprintln(w, scanner.Text())
+		}
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println(err)
+		if sse {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+		}
+	}
+}
+
+// FetchRuntimeLogsHandler serves requests at /runtime/logs. The pod is
+// picked by ?runtimeId= or ?pod=, which must be a runtime pod. With
+// follow=true the logs are streamed, as Server-Sent Events if the client
+// asks for text/event-stream or passes format=sse.
+func FetchRuntimeLogsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		namespace := query.Get("namespace")
+		runtimeId := query.Get("runtimeId")
+		podName := query.Get("pod")
+
+		if len(runtimeId) == 0 && len(podName) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		opts, err := parseLogOptions(r)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		podName, err = k8s.RuntimePod(ctx, namespace, runtimeId, podName)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		logs, err := k8s.StreamPodLogs(ctx, namespace, podName, opts)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer logs.Close()
+
+		sse := query.Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+		streamLines(w, logs, sse)
+	})
+}
@@ -0,0 +1,551 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+const (
+	// dns1123Pattern is the rule Helm applies to release names
+	dns1123Pattern = `^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// labelValuePattern is the rule Kubernetes applies to label values
+	labelValuePattern = `^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`
+)
+
+// OpenAPI is the root of an OpenAPI 3 document
+type OpenAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components OpenAPIComponents                `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	Summary     string              `json:"summary"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string `json:"description"`
+}
+
+// Helpers to keep the spec below readable
+
+func str(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+func boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+func integer(description string) *Schema {
+	zero := 0.0
+	return &Schema{Type: "integer", Minimum: &zero, Description: description}
+}
+
+func duration(description string) *Schema {
+	return &Schema{Type: "string", Format: "duration", Description: description}
+}
+
+func dateTime(description string) *Schema {
+	return &Schema{Type: "string", Format: "date-time", Description: description}
+}
+
+func enum(description string, values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values, Description: description}
+}
+
+func array(items *Schema, description string) *Schema {
+	return &Schema{Type: "array", Items: items, Description: description}
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func freeObject(description string) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: true, Description: description}
+}
+
+func stringMap(description string) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}, Description: description}
+}
+
+// object is a closed object: fields that are not listed are rejected
+func object(required []string, properties map[string]*Schema) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required, AdditionalProperties: false}
+}
+
+func inPath(name string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "path", Required: true, Schema: schema}
+}
+
+func inQuery(name string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: schema.Description, Schema: schema}
+}
+
+var responseDescriptions = map[string]string{
+	"101": "Switching to WebSocket",
+	"200": "OK",
+	"201": "Created",
+	"202": "Accepted",
+	"204": "Done",
+	"400": "Invalid request",
+	"403": "Forbidden, or quota exceeded",
+	"404": "Not found",
+	"409": "The runtime already exists or is busy, or a request with the same Idempotency-Key is in progress",
+	"422": "The Idempotency-Key was used for a different request",
+	"500": "Internal error",
+	"502": "Could not reach the pod",
+}
+
+// op builds an operation. body names the component schema of the request
+// body, if any.
+func op(tag string, summary string, body string, codes []string, params ...Parameter) *Operation {
+	o := &Operation{
+		Summary:    summary,
+		Tags:       []string{tag},
+		Parameters: params,
+		Responses:  make(map[string]Response, len(codes)),
+	}
+	for _, code := range codes {
+		o.Responses[code] = Response{Description: responseDescriptions[code]}
+	}
+	if len(body) > 0 {
+		o.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: ref(body)}},
+		}
+	}
+	return o
+}
+
+func codes(c ...string) []string {
+	return c
+}
+
+func componentSchemas() map[string]*Schema {
+	runtimeIds := array(ref("RuntimeId"), "IDs of the runtimes to act on")
+
+	return map[string]*Schema{
+		"RuntimeId": {
+			Type:        "string",
+			Pattern:     dns1123Pattern,
+			MaxLength:   client.ReleaseNameMaxLength - len("rt-"),
+			Description: "ID of a runtime; rt-<id> must be a valid Helm release name",
+		},
+		"ReleaseName": {
+			Type:        "string",
+			Pattern:     dns1123Pattern,
+			MaxLength:   client.ReleaseNameMaxLength,
+			Description: "Helm release name (DNS-1123)",
+		},
+		"Owner": {
+			Type:        "string",
+			Pattern:     labelValuePattern,
+			MaxLength:   63,
+			Description: "User owning a runtime, used as a label value",
+		},
+		"RestartStrategy": enum("How pods are replaced, helm by default", "helm", "rollout", "delete-pods"),
+		"MergeStrategy":   enum("How values are merged with the current ones", "reuse-values", "merge-patch", "json-patch", "replace"),
+		"InstallRequest": object([]string{"chartName", "releaseName"}, map[string]*Schema{
+			"chartName":         str("Chart to install"),
+			"releaseName":       ref("ReleaseName"),
+			"privateChartsRepo": str("Repo URL of the chart"),
+			"values":            freeObject("Chart values; {\"$secretRef\": {...}} objects are resolved from Secrets into a Secret of the release, and reach the chart as {\"secretKeyRef\": {...}}"),
+			"flags":             array(str(""), "Extra helm flags"),
+		}),
+		"DeleteRequest": object([]string{"releaseName"}, map[string]*Schema{
+			"releaseName": ref("ReleaseName"),
+		}),
+		"RepoAddRequest": object([]string{"name", "url"}, map[string]*Schema{
+			"name": str("Name of the repo"),
+			"url":  str("URL of the repo"),
+		}),
+		"RepoRemoveRequest": object([]string{"repos"}, map[string]*Schema{
+			"repos": array(str(""), "Names of the repos to remove"),
+		}),
+		"RuntimeSpec": object([]string{"runtimeId", "owner", "privateChartsRepo"}, map[string]*Schema{
+			"runtimeId":         ref("RuntimeId"),
+			"owner":             ref("Owner"),
+			"privateChartsRepo": str("Repo URL of the mayanr chart"),
+			"values":            freeObject("Values on top of the server side template"),
+		}),
+		"RolloutOptions": object(nil, map[string]*Schema{
+			"canarySize":    integer("Runtimes handled first; any failure among them halts the rollout"),
+			"waveSize":      integer("Runtimes handled at once after the canary, 0 for all"),
+			"maxFailures":   integer("Failures tolerated before halting"),
+			"rollback":      boolean("Roll back handled runtimes when halted"),
+			"verifyTimeout": duration("How long to wait for pods to become ready, 5m by default"),
+		}),
+		"RuntimeUpgrade": object(nil, map[string]*Schema{
+			"chartVersion":      str("mayanr version to move to, the current one if empty"),
+			"privateChartsRepo": str("Replaces the repo the chart is pulled from"),
+			"values":            {Description: "Values, or a JSON patch with the json-patch strategy"},
+			"strategy":          ref("MergeStrategy"),
+			"timeout":           duration("helm --timeout"),
+			"dryRun":            boolean("Only render the merged values"),
+		}),
+		"ReaperOverride": object([]string{"action"}, map[string]*Schema{
+			"action": enum("What the reaper does to the runtime", "skip", "suspend", "delete"),
+			"until":  dateTime("When the override ends"),
+		}),
+		"CreateRuntimesRequest": object([]string{"runtimes"}, map[string]*Schema{
+			"runtimes":   array(ref("RuntimeSpec"), "Runtimes to create"),
+			"concurrent": boolean("Create all runtimes at once"),
+			"timeout":    duration("helm --timeout"),
+		}),
+		"RestartRuntimesRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds": runtimeIds,
+			"concurrent": boolean("Restart all runtimes at once"),
+			"timeout":    duration("How long to wait for each runtime"),
+			"strategy":   ref("RestartStrategy"),
+			"rollout":    ref("RolloutOptions"),
+		}),
+		"UpgradeRuntimesRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds":        runtimeIds,
+			"chartVersion":      str("mayanr version to move to, the current one if empty"),
+			"privateChartsRepo": str("Replaces the repo the chart is pulled from"),
+			"values":            {Description: "Values, or a JSON patch with the json-patch strategy"},
+			"strategy":          ref("MergeStrategy"),
+			"dryRun":            boolean("Only render the merged values"),
+			"concurrent":        boolean("Upgrade all runtimes at once"),
+			"timeout":           duration("helm --timeout"),
+			"rollout":           ref("RolloutOptions"),
+		}),
+		"DeleteRuntimesRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds": runtimeIds,
+			"concurrent": boolean("Delete all runtimes at once"),
+			"timeout":    duration("helm --timeout"),
+		}),
+		"SuspendRuntimesRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds": runtimeIds,
+			"concurrent": boolean("Suspend all runtimes at once"),
+		}),
+		"ResumeRuntimesRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds": runtimeIds,
+			"concurrent": boolean("Resume all runtimes at once"),
+			"timeout":    duration("How long to wait for each runtime, 5m by default"),
+		}),
+		"RuntimeStatusRequest": object([]string{"runtimeIds"}, map[string]*Schema{
+			"runtimeIds": runtimeIds,
+			"concurrent": boolean("Look all runtimes up at once"),
+		}),
+		"ListPodsRequest": object(nil, map[string]*Schema{
+			"users":         array(ref("Owner"), "Only pods of these users"),
+			"namespace":     str("Namespace, all if empty"),
+			"labels":        stringMap("Labels the pods must have"),
+			"phase":         enum("Pod phase", "Pending", "Running", "Succeeded", "Failed", "Unknown"),
+			"node":          str("Node the pods run on"),
+			"createdAfter":  dateTime("Only pods created at or after this time"),
+			"fieldSelector": str("Pod field selector"),
+			"limit":         integer("Page size"),
+			"continue":      str("Continue token of the previous page"),
+			"sortBy":        enum("Sort key", "name", "createdAt", "-createdAt"),
+			"live":          boolean("Ask the API server instead of the cache"),
+		}),
+		"GetPodRequest": object([]string{"name"}, map[string]*Schema{
+			"name":      str("Pod name"),
+			"namespace": str("Namespace of the pod"),
+			"live":      boolean("Ask the API server instead of the cache"),
+		}),
+		"MetricsRequest": object(nil, map[string]*Schema{
+			"users":     array(ref("Owner"), "Only pods of these users"),
+			"namespace": str("Namespace, all if empty"),
+		}),
+		"EventsRequest": object([]string{"runtimeId"}, map[string]*Schema{
+			"runtimeId":    ref("RuntimeId"),
+			"namespace":    str("Namespace of the runtime"),
+			"warningsOnly": boolean("Only Warning events"),
+			"limit":        integer("Most recent events to return, all if 0"),
+		}),
+		"ReaperOverrideRequest": object([]string{"runtimeId"}, map[string]*Schema{
+			"runtimeId": ref("RuntimeId"),
+			"action":    enum("Override, or empty to remove it", "", "skip", "suspend", "delete"),
+			"until":     dateTime("When the override ends"),
+		}),
+	}
+}
+
+// podFilterParams are the query parameters of the pod lists of /v1
+func podFilterParams() []Parameter {
+	return []Parameter{
+		inQuery("users", str("Comma separated users")),
+		inQuery("label", str("key=value, can be repeated")),
+		inQuery("phase", enum("Pod phase", "Pending", "Running", "Succeeded", "Failed", "Unknown")),
+		inQuery("node", str("Node the pods run on")),
+		inQuery("createdAfter", dateTime("Only pods created at or after this time")),
+		inQuery("fieldSelector", str("Pod field selector")),
+		inQuery("namespace", str("Namespace, all if empty")),
+		inQuery("limit", integer("Page size")),
+		inQuery("continue", str("Continue token of the previous page")),
+		inQuery("sortBy", enum("Sort key", "name", "createdAt", "-createdAt")),
+		inQuery("live", boolean("Ask the API server instead of the cache")),
+	}
+}
+
+func logParams() []Parameter {
+	return []Parameter{
+		inQuery("namespace", str("Namespace of the pod")),
+		inQuery("container", str("Container, the only one if empty")),
+		inQuery("previous", boolean("Logs of the previous instance of the container")),
+		inQuery("follow", boolean("Stream the logs")),
+		inQuery("timestamps", boolean("Prefix lines with timestamps")),
+		inQuery("tailLines", integer("Lines from the end")),
+		inQuery("since", duration("Only logs newer than this")),
+		inQuery("format", enum("sse for Server-Sent Events", "sse")),
+	}
+}
+
+func buildOpenAPISpec() *OpenAPI {
+	runtimeId := inPath("id", ref("RuntimeId"))
+	timeout := inQuery("timeout", duration("helm --timeout, or how long to wait"))
+	namespace := inQuery("namespace", str("Namespace, the default one if empty"))
+
+	paths := map[string]map[string]*Operation{
+		// Legacy routes, which accept any method
+		"/install":     {"post": op("charts", "Install or upgrade a chart", "InstallRequest", codes("201", "400", "403", "409", "500"))},
+		"/delete":      {"post": op("charts", "Uninstall a release", "DeleteRequest", codes("201", "400", "500"))},
+		"/repo/add":    {"post": op("repos", "Add a chart repo", "RepoAddRequest", codes("201", "400", "500"))},
+		"/repo/delete": {"post": op("repos", "Remove chart repos", "RepoRemoveRequest", codes("201", "400", "500"))},
+		"/repo/update": {"post": op("repos", "Update the chart repos", "", codes("201", "500"))},
+
+		"/runtime/create":  {"post": op("runtimes", "Create runtimes", "CreateRuntimesRequest", codes("200", "400"))},
+		"/runtime/restart": {"post": op("runtimes", "Restart runtimes, or start a rollout doing so", "RestartRuntimesRequest", codes("200", "202", "400", "500"))},
+		"/runtime/delete":  {"post": op("runtimes", "Delete runtimes", "DeleteRuntimesRequest", codes("200", "400"))},
+		"/runtime/upgrade": {"post": op("runtimes", "Upgrade runtimes, or start a rollout doing so", "UpgradeRuntimesRequest", codes("200", "202", "400", "500"))},
+		"/runtime/suspend": {"post": op("runtimes", "Scale runtimes to zero", "SuspendRuntimesRequest", codes("200", "400"))},
+		"/runtime/resume":  {"post": op("runtimes", "Bring suspended runtimes back", "ResumeRuntimesRequest", codes("200", "400"))},
+		"/runtime/rollout-status": {"get": op("runtimes", "Progress of a rollout", "", codes("200", "400", "404"),
+			Parameter{Name: "id", In: "query", Required: true, Schema: str("Rollout ID")})},
+		"/runtime/status":    {"post": op("runtimes", "Release and pod state of runtimes", "RuntimeStatusRequest", codes("200", "400"))},
+		"/runtime/list-pods": {"post": op("pods", "List runtime pods", "ListPodsRequest", codes("200", "400", "500"))},
+		"/runtime/get-pod":   {"post": op("pods", "Get a runtime pod", "GetPodRequest", codes("200", "400", "500"))},
+		"/runtime/metrics":   {"post": op("pods", "CPU and memory usage of runtime pods", "MetricsRequest", codes("200", "400", "500"))},
+		"/runtime/events":    {"post": op("runtimes", "Kubernetes events of a runtime", "EventsRequest", codes("200", "400", "500"))},
+		"/runtime/logs": {"get": op("pods", "Logs of a runtime pod", "", codes("200", "400", "404", "500"),
+			append(logParams(), inQuery("runtimeId", ref("RuntimeId")), inQuery("pod", str("Name of a runtime pod, instead of runtimeId")))...)},
+		"/runtime/watch": {"get": op("pods", "Stream runtime pod changes as Server-Sent Events", "", codes("200"),
+			inQuery("users", str("Comma separated users")), inQuery("namespace", str("Namespace, all if empty")))},
+		"/runtime/exec": {"get": op("support", "Run a command in a runtime pod over WebSocket (SUPPORT_TOKENS)", "", codes("101", "403", "404"),
+			inQuery("runtimeId", ref("RuntimeId")), inQuery("pod", str("Name of a runtime pod, instead of runtimeId")),
+			inQuery("command", str("Command and arguments, repeated")), inQuery("container", str("Container")),
+			inQuery("tty", boolean("Allocate a terminal")), namespace)},
+		"/runtime/port-forward": {"get": op("support", "Forward a port of a runtime pod over WebSocket (SUPPORT_TOKENS)", "", codes("101", "400", "403", "404"),
+			inQuery("runtimeId", ref("RuntimeId")), inQuery("pod", str("Name of a runtime pod, instead of runtimeId")),
+			Parameter{Name: "port", In: "query", Required: true, Schema: integer("Port of the pod")}, namespace)},
+		"/quota/{user}":    {"get": op("quotas", "Quota limits and usage of a user", "", codes("200", "400", "500"), inPath("user", ref("Owner")))},
+		"/reaper/plan":     {"get": op("reaper", "Upcoming and last actions of the reaper", "", codes("200", "404", "500"))},
+		"/reaper/override": {"post": op("reaper", "Override the reaper for a runtime", "ReaperOverrideRequest", codes("200", "400"))},
+		"/healthcheck":     {"get": op("meta", "Health check", "", codes("200"))},
+		"/openapi.json":    {"get": op("meta", "This document", "", codes("200"))},
+		"/docs":            {"get": op("meta", "Documentation of this API", "", codes("200"))},
+
+		// Versioned REST API
+		"/v1/runtimes": {
+			"get":  op("runtimes", "List runtimes", "", codes("200", "400", "500"), podFilterParams()...),
+			"post": op("runtimes", "Create a runtime", "RuntimeSpec", codes("201", "400", "403", "409", "422", "500"), timeout),
+		},
+		"/v1/runtimes/{id}": {
+			"get":    op("runtimes", "Release and pod state of a runtime", "", codes("200", "404", "500"), runtimeId),
+			"delete": op("runtimes", "Delete a runtime", "", codes("204", "404", "409", "422", "500"), runtimeId, timeout),
+		},
+		"/v1/runtimes/{id}/pods":    {"get": op("runtimes", "Pods of a runtime", "", codes("200", "400", "500"), append([]Parameter{runtimeId}, podFilterParams()...)...)},
+		"/v1/runtimes/{id}/events":  {"get": op("runtimes", "Kubernetes events of a runtime", "", codes("200", "400", "500"), runtimeId, namespace, inQuery("warningsOnly", boolean("Only Warning events")), inQuery("limit", integer("Most recent events to return")))},
+		"/v1/runtimes/{id}/logs":    {"get": op("runtimes", "Logs of a runtime", "", codes("200", "400", "404", "500"), append([]Parameter{runtimeId}, logParams()...)...)},
+		"/v1/runtimes/{id}/metrics": {"get": op("runtimes", "CPU and memory usage of a runtime", "", codes("200", "400", "500"), runtimeId, namespace)},
+		"/v1/runtimes/{id}:restart": {"post": op("runtimes", "Restart a runtime", "", codes("204", "400", "404", "409", "422", "500"), runtimeId, timeout, inQuery("strategy", ref("RestartStrategy")))},
+		"/v1/runtimes/{id}:upgrade": {"post": op("runtimes", "Upgrade a runtime", "RuntimeUpgrade", codes("200", "400", "404", "409", "422", "500"), runtimeId)},
+		"/v1/runtimes/{id}:rollback": {"post": op("runtimes", "Roll a runtime back", "", codes("204", "400", "404", "409", "422", "500"), runtimeId, timeout,
+			inQuery("revision", integer("Revision to roll back to, the previous one if empty")))},
+		"/v1/runtimes/{id}:suspend": {"post": op("runtimes", "Scale a runtime to zero", "", codes("204", "400", "404", "409", "422", "500"), runtimeId)},
+		"/v1/runtimes/{id}:resume":  {"post": op("runtimes", "Bring a suspended runtime back", "", codes("204", "400", "404", "409", "422", "500"), runtimeId, timeout)},
+
+		"/v1/pods":       {"get": op("pods", "List runtime pods", "", codes("200", "400", "500"), podFilterParams()...)},
+		"/v1/pods:watch": {"get": op("pods", "Stream runtime pod changes as Server-Sent Events", "", codes("200"), inQuery("users", str("Comma separated users")), inQuery("namespace", str("Namespace, all if empty")))},
+		"/v1/pods/{namespace}/{name}": {"get": op("pods", "Get a runtime pod", "", codes("200", "404", "500"),
+			inPath("namespace", str("")), inPath("name", str("")), inQuery("live", boolean("Ask the API server instead of the cache")))},
+
+		"/v1/releases":        {"post": op("charts", "Install or upgrade a chart", "InstallRequest", codes("201", "400", "403", "409", "422", "500"))},
+		"/v1/releases/{name}": {"delete": op("charts", "Uninstall a release", "", codes("204", "400", "409", "422", "500"), inPath("name", ref("ReleaseName")), timeout)},
+
+		"/v1/repos":        {"post": op("repos", "Add a chart repo", "RepoAddRequest", codes("201", "400", "409", "422", "500"))},
+		"/v1/repos/{name}": {"delete": op("repos", "Remove a chart repo", "", codes("204", "409", "422", "500"), inPath("name", str("")))},
+		"/v1/repos:update": {"post": op("repos", "Update the chart repos", "", codes("201", "409", "422", "500"))},
+
+		"/v1/rollouts/{id}": {"get": op("runtimes", "Progress of a rollout", "", codes("200", "404"), inPath("id", str("Rollout ID")))},
+		"/v1/quotas/{user}": {"get": op("quotas", "Quota limits and usage of a user", "", codes("200", "400", "500"), inPath("user", ref("Owner")))},
+		"/v1/reaper/plan":   {"get": op("reaper", "Upcoming and last actions of the reaper", "", codes("200", "404", "500"))},
+		"/v1/reaper/overrides/{id}": {
+			"put":    op("reaper", "Override the reaper for a runtime", "ReaperOverride", codes("200", "400", "409", "422"), runtimeId),
+			"delete": op("reaper", "Remove the override of a runtime", "", codes("204", "409", "422", "500"), runtimeId),
+		},
+	}
+
+	return &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "helmAPI",
+			Description: "Deploy and manage Helm charts and user runtimes. Mutating endpoints accept an Idempotency-Key header.",
+			Version:     "1",
+		},
+		Paths:      paths,
+		Components: OpenAPIComponents{Schemas: componentSchemas()},
+	}
+}
+
+var (
+	spec     *OpenAPI
+	specOnce sync.Once
+)
+
+// openAPISpec returns the spec of the API, which is built once
+func openAPISpec() *OpenAPI {
+	specOnce.Do(func() {
+		spec = buildOpenAPISpec()
+	})
+	return spec
+}
+
+// operationFor finds the operation documented for a path pattern. Legacy
+// routes accept any method, so they fall back to their documented one.
+func operationFor(pattern string, method string) *Operation {
+	ops, ok := openAPISpec().Paths[pattern]
+	if !ok {
+		return nil
+	}
+	if o, ok := ops[strings.ToLower(method)]; ok {
+		return o
+	}
+	if strings.HasPrefix(pattern, "/v1/") {
+		return nil
+	}
+	for _, o := range ops {
+		return o
+	}
+	return nil
+}
+
+// Validated checks requests against the operation documented for pattern
+// in the spec before passing them on: path and query parameters, and the
+// JSON body. Problems are reported with 400 and {"error", "details"}.
+func Validated(pattern string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := operationFor(pattern, r.Method)
+		if o == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		problems := []string{}
+		query := r.URL.Query()
+		for _, p := range o.Parameters {
+			// Path parameters are only known on routes of the router, which
+			// never matches empty segments
+			if p.In == "path" {
+				if value := pathParam(r, p.Name); len(value) > 0 {
+					problems = append(problems, p.Schema.validateParam(p.Name, value)...)
+				}
+				continue
+			}
+
+			values, present := query[p.Name]
+			if !present && p.Required {
+				problems = append(problems, p.Name+": is required")
+			}
+			for _, value := range values {
+				problems = append(problems, p.Schema.validateParam(p.Name, value)...)
+			}
+		}
+
+		if o.RequestBody != nil {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			if len(bytes.TrimSpace(body)) > 0 {
+				var value interface{}
+				decoder := json.NewDecoder(bytes.NewReader(body))
+				decoder.UseNumber()
+				if err := decoder.Decode(&value); err != nil {
+					problems = append(problems, "body: "+err.Error())
+				} else {
+					problems = append(problems, o.RequestBody.Content["application/json"].Schema.validate("", value)...)
+				}
+			} else if o.RequestBody.Required && r.Method != http.MethodGet {
+				problems = append(problems, "body: is required")
+			}
+		}
+
+		if len(problems) > 0 {
+			writeJSON(w, http.StatusBadRequest, client.ErrorResponse{Error: "invalid request", Details: problems})
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// OpenAPIHandler serves the spec at /openapi.json
+func OpenAPIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(openAPISpec()); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// DocsHandler serves a page at /docs that renders /openapi.json. It has no
+// dependencies, so it works without internet access.
+func DocsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(docsPage))
+	})
+}
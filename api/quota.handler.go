@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// QuotaHandler serves requests at /quota/{user} with the limits of the user
+// and what their runtimes use
+func QuotaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := strings.TrimPrefix(r.URL.Path, "/quota/")
+		if len(user) == 0 || strings.Contains(user, "/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		quota, err := client.GetQuota(r.Context(), user)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(quota)
+	})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// ReaperPlanHandler serves requests at /reaper/plan. It lists what the reaper
+// is going to do, and what it did in its last run on any replica.
+func ReaperPlanHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, err := client.LoadReaperPolicy()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if policy == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		actions, err := client.PlanReaper(r.Context(), *policy)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		lastRun, err := client.LastReaperReport(r.Context())
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		payload := struct {
+			Policy  client.ReaperPolicy   `json:"policy"`
+			Actions []client.ReaperAction `json:"actions"`
+			LastRun *client.ReaperReport  `json:"lastRun,omitempty"`
+		}{
+			Policy:  *policy,
+			Actions: actions,
+			LastRun: lastRun,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
+// ReaperOverrideHandler serves requests at /reaper/override. An empty action
+// removes the override of the runtime.
+func ReaperOverrideHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeId string     `json:"runtimeId"`
+			Action    string     `json:"action"`
+			Until     *time.Time `json:"until"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil || len(data.RuntimeId) == 0 {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var override *client.ReaperOverride
+		if len(data.Action) > 0 {
+			override = &client.ReaperOverride{Action: data.Action, Until: data.Until}
+		}
+
+		err = client.SetReaperOverride(r.Context(), data.RuntimeId, override)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// startRollout starts a rollout of a batch runtime operation and
+// responds with the ID to track its progress with
+func startRollout(w http.ResponseWriter, operation string, params interface{}, runtimeIds []string, opts client.RolloutOptions, timeout string) {
+	ro, err := client.StartRollout(operation, params, runtimeIds, opts, timeout)
+	if rerr, ok := err.(*client.InvalidRolloutError); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(client.ErrorResponse{Error: rerr.Error()})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	payload := struct {
+		RolloutId string `json:"rolloutId"`
+	}{RolloutId: ro.ID}
+	json.NewEncoder(w).Encode(payload)
+}
+
+// RolloutStatusHandler serves requests at /runtime/rollout-status
+func RolloutStatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if len(id) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ro, ok := client.GetRollout(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ro)
+	})
+}
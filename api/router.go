@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// router dispatches requests on their method and path. In patterns, a
+// {name} segment captures a path parameter, and may be followed by a
+// :action suffix as in runtimes/{id}:restart. Paths that match with the
+// wrong method get 405 with an Allow header.
+type router struct {
+	prefix string
+	routes []route
+}
+
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+type pathParamsKey struct{}
+
+func newRouter(prefix string) *router {
+	return &router{prefix: prefix}
+}
+
+// handle registers a handler. Requests are validated against the spec of
+// the route, and handlers of mutating methods honour the Idempotency-Key
+// header.
+func (rt *router) handle(method string, pattern string, h http.Handler) {
+	if method != http.MethodGet {
+		h = Idempotent(h)
+	}
+	h = Validated(rt.prefix+"/"+pattern, h)
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler:  h,
+	})
+}
+
+func (rt *router) handleFunc(method string, pattern string, h http.HandlerFunc) {
+	rt.handle(method, pattern, h)
+}
+
+// matchSegments returns the path parameters if the path matches the pattern
+func matchSegments(pattern []string, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, p := range pattern {
+		if !strings.HasPrefix(p, "{") {
+			if p != path[i] {
+				return nil, false
+			}
+			continue
+		}
+
+		end := strings.Index(p, "}")
+		name, suffix := p[1:end], p[end+1:]
+		value := path[i]
+		if len(suffix) > 0 {
+			if !strings.HasSuffix(value, suffix) {
+				return nil, false
+			}
+			value = strings.TrimSuffix(value, suffix)
+		} else if strings.Contains(value, ":") {
+			return nil, false
+		}
+		if len(value) == 0 {
+			return nil, false
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, rt.prefix), "/"), "/")
+
+	allowed := []string{}
+	for _, route := range rt.routes {
+		params, ok := matchSegments(route.segments, path)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+
+		ctx := context.WithValue(r.Context(), pathParamsKey{}, params)
+		route.handler.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// pathParam returns a parameter captured from the path by the router
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+// writeJSON responds with a JSON payload
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// writeError responds with a JSON {"error": ...} payload
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, client.ErrorResponse{Error: err.Error()})
+}
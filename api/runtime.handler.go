@@ -3,21 +3,93 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/dush-t/helmapi/client"
 	"github.com/dush-t/helmapi/client/k8s"
 )
 
+// CreateRuntimeHandler serves requests at /runtime/create
+func CreateRuntimeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Runtimes   []client.RuntimeSpec `json:"runtimes"`
+			Concurrent bool                 `json:"concurrent"`
+			Timeout    string               `json:"timeout"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		specs := make(map[string]client.RuntimeSpec, len(data.Runtimes))
+		runtimeIds := make([]string, len(data.Runtimes))
+		invalid := make(map[string]string)
+		for i, rs := range data.Runtimes {
+			// A second spec would replace the first, and both would run
+			if _, ok := specs[rs.RuntimeId]; ok {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("runtime %s is listed more than once", rs.RuntimeId))
+				return
+			}
+			if err := rs.Validate(); err != nil {
+				invalid[rs.RuntimeId] = err.Error()
+			}
+			specs[rs.RuntimeId] = rs
+			runtimeIds[i] = rs.RuntimeId
+		}
+
+		// Nothing is installed unless every spec is valid
+		if len(invalid) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(struct {
+				Errors map[string]string `json:"errors"`
+			}{Errors: invalid})
+			return
+		}
+
+		errs := runForEach(runtimeIds, data.Concurrent, func(runtimeId string) error {
+			return client.CreateRuntime(specs[runtimeId], data.Timeout)
+		})
+
+		created := make(map[string]bool)
+		failures := make(map[string]string)
+		for runtimeId, err := range errs {
+			created[runtimeId] = err == nil
+			if err != nil {
+				failures[runtimeId] = err.Error()
+			}
+		}
+
+		payload := struct {
+			Created map[string]bool   `json:"created"`
+			Errors  map[string]string `json:"errors,omitempty"`
+		}{
+			Created: created,
+			Errors:  failures,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
 func RestartRuntimeHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// data := make(map[string]interface{})
 		data := struct {
-			RuntimeIds []string `json:"runtimeIds"`
-			Concurrent bool     `json:"concurrent"`
-			Timeout    string   `json:"timeout"`
+			RuntimeIds []string               `json:"runtimeIds"`
+			Concurrent bool                   `json:"concurrent"`
+			Timeout    string                 `json:"timeout"`
+			Strategy   client.RestartStrategy `json:"strategy"`
+			Rollout    *client.RolloutOptions `json:"rollout"`
 		}{}
 
 		err := json.NewDecoder(r.Body).Decode(&data)
@@ -26,54 +98,230 @@ func RestartRuntimeHandler() http.Handler {
 			return
 		}
 
-		concurrent := data.Concurrent
-		runtimeIds := data.RuntimeIds
-		timeout := data.Timeout
+		if data.Rollout != nil {
+			params := struct {
+				Strategy client.RestartStrategy `json:"strategy"`
+				Timeout  string                 `json:"timeout"`
+			}{Strategy: data.Strategy, Timeout: data.Timeout}
+			startRollout(w, "restart", params, data.RuntimeIds, *data.Rollout, data.Timeout)
+			return
+		}
+
+		errs := runForEach(data.RuntimeIds, data.Concurrent, func(runtimeId string) error {
+			return client.RestartRuntimeWithStrategy(runtimeId, data.Strategy, data.Timeout)
+		})
 
 		result := make(map[string]bool)
+		warnings := make(map[string][]k8s.EventSummary)
+		for runtimeId, err := range errs {
+			result[runtimeId] = err == nil
+			if err == nil {
+				continue
+			}
 
-		n := len(runtimeIds)
-		if !concurrent {
-			for i := 0; i < n; i++ {
-				err = client.RestartRuntime(runtimeIds[i], timeout)
-				if err != nil {
-					result[runtimeIds[i]] = false
-					continue
-				}
-				result[runtimeIds[i]] = true
+			// The reason a restart failed is usually in the events
+			// of the runtime, e.g. a failed image pull
+			events, eerr := k8s.GetRuntimeEvents(r.Context(), "", runtimeId, true, 5)
+			if eerr != nil {
+				log.Println(eerr)
+				continue
 			}
-		} else {
-			resultChan := make(chan []string)
-			defer close(resultChan)
+			warnings[runtimeId] = events
+		}
 
-			for _, rId := range runtimeIds {
-				runtimeId := rId
-				go func() {
-					err := client.RestartRuntime(runtimeId, timeout)
-					if err != nil {
-						resultChan <- []string{runtimeId, "FAIL"}
-						return
-					}
+		payload := struct {
+			Restarted map[string]bool               `json:"restarted"`
+			Warnings  map[string][]k8s.EventSummary `json:"warnings,omitempty"`
+		}{
+			Restarted: result,
+			Warnings:  warnings,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
 
-					resultChan <- []string{runtimeId, "SUCCESS"}
-				}()
+// FetchRuntimeEventsHandler serves requests at /runtime/events
+func FetchRuntimeEventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeId    string `json:"runtimeId"`
+			Namespace    string `json:"namespace"`
+			WarningsOnly bool   `json:"warningsOnly"`
+			Limit        int    `json:"limit"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil || len(data.RuntimeId) == 0 {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		events, err := k8s.GetRuntimeEvents(r.Context(), data.Namespace, data.RuntimeId, data.WarningsOnly, data.Limit)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		payload := struct {
+			Events []k8s.EventSummary `json:"events"`
+		}{Events: events}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
+// UpgradeRuntimeHandler serves requests at /runtime/upgrade
+func UpgradeRuntimeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeIds        []string               `json:"runtimeIds"`
+			ChartVersion      string                 `json:"chartVersion"`
+			PrivateChartsRepo string                 `json:"privateChartsRepo"`
+			Values            json.RawMessage        `json:"values"`
+			Strategy          client.MergeStrategy   `json:"strategy"`
+			DryRun            bool                   `json:"dryRun"`
+			Concurrent        bool                   `json:"concurrent"`
+			Timeout           string                 `json:"timeout"`
+			Rollout           *client.RolloutOptions `json:"rollout"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		upgrade := client.RuntimeUpgrade{
+			ChartVersion:      data.ChartVersion,
+			PrivateChartsRepo: data.PrivateChartsRepo,
+			Values:            data.Values,
+			Strategy:          data.Strategy,
+			Timeout:           data.Timeout,
+			DryRun:            data.DryRun,
+		}
+
+		if data.Rollout != nil && !data.DryRun {
+			startRollout(w, "upgrade", upgrade, data.RuntimeIds, *data.Rollout, data.Timeout)
+			return
+		}
+
+		var mu sync.Mutex
+		results := make(map[string]client.RuntimeUpgradeResult)
+		errs := runForEach(data.RuntimeIds, data.Concurrent, func(runtimeId string) error {
+			res, err := client.UpgradeRuntime(runtimeId, upgrade)
+			if err != nil {
+				return err
 			}
 
-			i := 0
-			for i < len(runtimeIds) {
-				d := <-resultChan
-				if d[1] == "SUCCESS" {
-					result[d[0]] = true
-				} else {
-					result[d[0]] = false
-				}
-				i += 1
+			mu.Lock()
+			results[runtimeId] = res
+			mu.Unlock()
+			return nil
+		})
+
+		upgraded := make(map[string]bool)
+		failures := make(map[string]string)
+		for runtimeId, err := range errs {
+			upgraded[runtimeId] = err == nil
+			if err != nil {
+				failures[runtimeId] = err.Error()
+			}
+		}
+
+		payload := struct {
+			Upgraded map[string]bool                        `json:"upgraded"`
+			Results  map[string]client.RuntimeUpgradeResult `json:"results"`
+			Errors   map[string]string                      `json:"errors,omitempty"`
+		}{
+			Upgraded: upgraded,
+			Results:  results,
+			Errors:   failures,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
+// SuspendRuntimeHandler serves requests at /runtime/suspend
+func SuspendRuntimeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeIds []string `json:"runtimeIds"`
+			Concurrent bool     `json:"concurrent"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		errs := runForEach(data.RuntimeIds, data.Concurrent, client.SuspendRuntime)
+
+		suspended := make(map[string]bool)
+		failures := make(map[string]string)
+		for runtimeId, err := range errs {
+			suspended[runtimeId] = err == nil
+			if err != nil {
+				failures[runtimeId] = err.Error()
 			}
 		}
 
 		payload := struct {
-			Restarted map[string]bool `json:"restarted"`
-		}{Restarted: result}
+			Suspended map[string]bool   `json:"suspended"`
+			Errors    map[string]string `json:"errors,omitempty"`
+		}{
+			Suspended: suspended,
+			Errors:    failures,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
+// ResumeRuntimeHandler serves requests at /runtime/resume
+func ResumeRuntimeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeIds []string `json:"runtimeIds"`
+			Concurrent bool     `json:"concurrent"`
+			Timeout    string   `json:"timeout"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		errs := runForEach(data.RuntimeIds, data.Concurrent, func(runtimeId string) error {
+			return client.ResumeRuntime(runtimeId, data.Timeout)
+		})
+
+		resumed := make(map[string]bool)
+		failures := make(map[string]string)
+		for runtimeId, err := range errs {
+			resumed[runtimeId] = err == nil
+			if err != nil {
+				failures[runtimeId] = err.Error()
+			}
+		}
+
+		payload := struct {
+			Resumed map[string]bool   `json:"resumed"`
+			Errors  map[string]string `json:"errors,omitempty"`
+		}{
+			Resumed: resumed,
+			Errors:  failures,
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(payload)
@@ -154,13 +402,71 @@ func DeleteRuntimeHandler() http.Handler {
 	})
 }
 
+// RuntimeStatusHandler serves requests at /runtime/status
+func RuntimeStatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			RuntimeIds []string `json:"runtimeIds"`
+			Concurrent bool     `json:"concurrent"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		var mu sync.Mutex
+		statuses := make(map[string]client.RuntimeStatus)
+		errs := runForEach(data.RuntimeIds, data.Concurrent, func(runtimeId string) error {
+			status, err := client.GetRuntimeStatus(ctx, runtimeId)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			statuses[runtimeId] = status
+			mu.Unlock()
+			return nil
+		})
+
+		failures := make(map[string]string)
+		for runtimeId, err := range errs {
+			if err != nil {
+				log.Println(runtimeId, err)
+				failures[runtimeId] = err.Error()
+			}
+		}
+
+		payload := struct {
+			Statuses map[string]client.RuntimeStatus `json:"statuses"`
+			Errors   map[string]string               `json:"errors,omitempty"`
+		}{
+			Statuses: statuses,
+			Errors:   failures,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	})
+}
+
 func FetchRuntimePodsHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data := struct {
-			Users     []string `json:"users"`
-			Namespace string   `json:"namespace"`
-			Limit     int64    `json:"limit"`
-			Continue  string   `json:"continue"`
+			Users         []string          `json:"users"`
+			Namespace     string            `json:"namespace"`
+			Labels        map[string]string `json:"labels"`
+			Phase         string            `json:"phase"`
+			Node          string            `json:"node"`
+			CreatedAfter  *time.Time        `json:"createdAfter"`
+			FieldSelector string            `json:"fieldSelector"`
+			Limit         int64             `json:"limit"`
+			Continue      string            `json:"continue"`
+			SortBy        string            `json:"sortBy"`
+			Live          bool              `json:"live"`
 		}{}
 
 		err := json.NewDecoder(r.Body).Decode(&data)
@@ -170,14 +476,34 @@ func FetchRuntimePodsHandler() http.Handler {
 			return
 		}
 
-		ctx := context.Background()
-		var selector string
-		if len(data.Users) > 0 {
-			selector = "userRuntimeOwner in (" + strings.Join(data.Users, ",") + "),mayaResourceType=userRuntime"
-		} else {
-			selector = "mayaResourceType=userRuntime"
+		selector, err := k8s.NewRuntimeSelector().Owners(data.Users...).Matching(data.Labels).String()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
-		pods, perr := k8s.GetPodsBySelector(ctx, data.Namespace, selector, data.Limit, data.Continue)
+
+		fieldSelector, err := k8s.PodFieldSelector(data.FieldSelector, map[string]string{
+			"status.phase":  data.Phase,
+			"spec.nodeName": data.Node,
+		})
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		pods, perr := k8s.ListRuntimePods(ctx, k8s.PodQuery{
+			Namespace:     data.Namespace,
+			Selector:      selector,
+			FieldSelector: fieldSelector,
+			CreatedAfter:  data.CreatedAfter,
+			Limit:         data.Limit,
+			Continue:      data.Continue,
+			SortBy:        data.SortBy,
+			Live:          data.Live,
+		})
 
 		if perr != nil {
 			log.Println(perr)
@@ -189,11 +515,46 @@ func FetchRuntimePodsHandler() http.Handler {
 	})
 }
 
+// FetchRuntimeMetricsHandler returns the CPU and memory usage of runtime
+// pods, per pod and container and summed per user
+func FetchRuntimeMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Users     []string `json:"users"`
+			Namespace string   `json:"namespace"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		selector, err := k8s.NewRuntimeSelector().Owners(data.Users...).String()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		metrics, err := k8s.GetRuntimeMetrics(r.Context(), data.Namespace, selector)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics)
+	})
+}
+
 func FetchRuntimePodByNameHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data := struct {
 			Name      string `json:"name"`
 			Namespace string `json:"namespace"`
+			Live      bool   `json:"live"`
 		}{}
 
 		err := json.NewDecoder(r.Body).Decode(&data)
@@ -204,7 +565,7 @@ func FetchRuntimePodByNameHandler() http.Handler {
 		}
 
 		ctx := context.Background()
-		podDetails, perr := k8s.GetPodByName(ctx, data.Namespace, data.Name)
+		podDetails, perr := k8s.GetRuntimePodByName(ctx, data.Namespace, data.Name, data.Live)
 		if perr != nil {
 			log.Println(perr)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI 3 schema object used by the spec of
+// this API, and understood by validate
+type Schema struct {
+	Ref         string   `json:"$ref,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	MaxLength   int      `json:"maxLength,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	// Properties and Required describe objects. AdditionalProperties is
+	// false for closed objects, true for free-form ones, or a *Schema.
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+var (
+	patternsMu sync.Mutex
+	patterns   = make(map[string]*regexp.Regexp)
+)
+
+func compiledPattern(pattern string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+
+	re, ok := patterns[pattern]
+	if !ok {
+		re = regexp.MustCompile(pattern)
+		patterns[pattern] = re
+	}
+	return re
+}
+
+// resolve follows a $ref to the components of the spec
+func (s *Schema) resolve() *Schema {
+	for s != nil && len(s.Ref) > 0 {
+		s = openAPISpec().Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber against the
+// schema and returns every problem found, prefixed with the path of the
+// offending value
+func (s *Schema) validate(path string, value interface{}) []string {
+	s = s.resolve()
+	if s == nil {
+		return nil
+	}
+
+	name := path
+	if len(name) == 0 {
+		name = "body"
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{name + ": must be an object"}
+		}
+		return s.validateObject(path, obj)
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{name + ": must be an array"}
+		}
+		problems := []string{}
+		for i, item := range items {
+			problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+		return problems
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{name + ": must be a string"}
+		}
+		return s.validateString(name, str)
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return []string{name + ": must be a " + s.Type}
+		}
+		if s.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return []string{name + ": must be an integer"}
+			}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return []string{name + ": must be a number"}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return []string{fmt.Sprintf("%s: must be at least %v", name, *s.Minimum)}
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{name + ": must be a boolean"}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}) []string {
+	problems := []string{}
+	prefix := path
+	if len(prefix) > 0 {
+		prefix += "."
+	}
+
+	for _, key := range s.Required {
+		if _, ok := obj[key]; !ok {
+			problems = append(problems, prefix+key+": is required")
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := obj[key]
+		if prop, ok := s.Properties[key]; ok {
+			// null is accepted for optional fields, like encoding/json does
+			if value == nil {
+				continue
+			}
+			problems = append(problems, prop.validate(prefix+key, value)...)
+			continue
+		}
+
+		switch extra := s.AdditionalProperties.(type) {
+		case *Schema:
+			problems = append(problems, extra.validate(prefix+key, value)...)
+		case bool:
+			if !extra {
+				problems = append(problems, prefix+key+": unknown field")
+			}
+		default:
+			problems = append(problems, prefix+key+": unknown field")
+		}
+	}
+
+	return problems
+}
+
+func (s *Schema) validateString(name string, str string) []string {
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if str == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{name + ": must be one of " + strings.Join(s.Enum, ", ")}
+		}
+	}
+
+	if s.MaxLength > 0 && len(str) > s.MaxLength {
+		return []string{fmt.Sprintf("%s: must be at most %d characters", name, s.MaxLength)}
+	}
+
+	if len(s.Pattern) > 0 && !compiledPattern(s.Pattern).MatchString(str) {
+		return []string{fmt.Sprintf("%s: must match %s", name, s.Pattern)}
+	}
+
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return []string{name + ": must be an RFC 3339 date-time"}
+		}
+	case "duration":
+		if _, err := time.ParseDuration(str); err != nil {
+			return []string{name + ": must be a duration like 5m or 1h30m"}
+		}
+	}
+
+	return nil
+}
+
+// validateParam checks a path or query parameter, which always arrives as
+// a string
+func (s *Schema) validateParam(name string, value string) []string {
+	s = s.resolve()
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return []string{name + ": must be an integer"}
+		}
+		if s.Minimum != nil && float64(n) < *s.Minimum {
+			return []string{fmt.Sprintf("%s: must be at least %v", name, *s.Minimum)}
+		}
+		return nil
+	case "boolean":
+		if value != "true" && value != "false" {
+			return []string{name + ": must be true or false"}
+		}
+		return nil
+	}
+
+	return s.validateString(name, value)
+}
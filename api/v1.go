@@ -0,0 +1,408 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/client/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// splitList reads a query parameter that can be repeated or comma separated
+func splitList(values []string) []string {
+	result := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+// podQueryFromURL reads the filters of a pod list from the query string:
+// users, label (key=value, repeatable), phase, node, createdAfter (RFC 3339),
+// fieldSelector, namespace, limit, continue, sortBy and live
+func podQueryFromURL(r *http.Request, selector *k8s.SelectorBuilder) (k8s.PodQuery, error) {
+	query := r.URL.Query()
+
+	labels := make(map[string]string)
+	for _, match := range query["label"] {
+		parts := strings.SplitN(match, "=", 2)
+		if len(parts) != 2 {
+			return k8s.PodQuery{}, fmt.Errorf("invalid label %s, expected key=value", match)
+		}
+		labels[parts[0]] = parts[1]
+	}
+
+	labelSelector, err := selector.Owners(splitList(query["users"])...).Matching(labels).String()
+	if err != nil {
+		return k8s.PodQuery{}, err
+	}
+
+	fieldSelector, err := k8s.PodFieldSelector(query.Get("fieldSelector"), map[string]string{
+		"status.phase":  query.Get("phase"),
+		"spec.nodeName": query.Get("node"),
+	})
+	if err != nil {
+		return k8s.PodQuery{}, err
+	}
+
+	podQuery := k8s.PodQuery{
+		Namespace:     query.Get("namespace"),
+		Selector:      labelSelector,
+		FieldSelector: fieldSelector,
+		Continue:      query.Get("continue"),
+		SortBy:        query.Get("sortBy"),
+		Live:          query.Get("live") == "true",
+	}
+
+	if createdAfter := query.Get("createdAfter"); len(createdAfter) > 0 {
+		t, err := time.Parse(time.RFC3339, createdAfter)
+		if err != nil {
+			return k8s.PodQuery{}, fmt.Errorf("invalid createdAfter %s", createdAfter)
+		}
+		podQuery.CreatedAfter = &t
+	}
+
+	if limit := query.Get("limit"); len(limit) > 0 {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			return k8s.PodQuery{}, fmt.Errorf("invalid limit %s", limit)
+		}
+		podQuery.Limit = n
+	}
+
+	return podQuery, nil
+}
+
+// V1Handler serves the versioned REST API under /v1
+func V1Handler() http.Handler {
+	rt := newRouter("/v1")
+
+	rt.handleFunc(http.MethodGet, "runtimes", listRuntimes)
+	rt.handleFunc(http.MethodPost, "runtimes", createRuntime)
+	rt.handleFunc(http.MethodGet, "runtimes/{id}", getRuntime)
+	rt.handleFunc(http.MethodDelete, "runtimes/{id}", deleteRuntime)
+	rt.handleFunc(http.MethodGet, "runtimes/{id}/pods", listRuntimePods)
+	rt.handleFunc(http.MethodGet, "runtimes/{id}/events", getRuntimeEvents)
+	rt.handleFunc(http.MethodGet, "runtimes/{id}/logs", getRuntimeLogs)
+	rt.handleFunc(http.MethodGet, "runtimes/{id}/metrics", getRuntimeMetrics)
+	rt.handleFunc(http.MethodPost, "runtimes/{id}:restart", restartRuntime)
+	rt.handleFunc(http.MethodPost, "runtimes/{id}:upgrade", upgradeRuntime)
+	rt.handleFunc(http.MethodPost, "runtimes/{id}:rollback", rollbackRuntime)
+	rt.handleFunc(http.MethodPost, "runtimes/{id}:suspend", suspendRuntime)
+	rt.handleFunc(http.MethodPost, "runtimes/{id}:resume", resumeRuntime)
+
+	rt.handleFunc(http.MethodGet, "pods", listPods)
+	rt.handle(http.MethodGet, "pods:watch", WatchRuntimePodsHandler())
+	rt.handleFunc(http.MethodGet, "pods/{namespace}/{name}", getPod)
+
+	rt.handle(http.MethodPost, "releases", InstallChartHandler())
+	rt.handleFunc(http.MethodDelete, "releases/{name}", deleteRelease)
+
+	rt.handle(http.MethodPost, "repos", AddRepoHandler())
+	rt.handleFunc(http.MethodDelete, "repos/{name}", removeRepo)
+	rt.handle(http.MethodPost, "repos:update", RepoUpdateHandler())
+
+	rt.handleFunc(http.MethodGet, "rollouts/{id}", getRollout)
+	rt.handleFunc(http.MethodGet, "quotas/{user}", getQuota)
+	rt.handle(http.MethodGet, "reaper/plan", ReaperPlanHandler())
+	rt.handleFunc(http.MethodPut, "reaper/overrides/{id}", setReaperOverride)
+	rt.handleFunc(http.MethodDelete, "reaper/overrides/{id}", deleteReaperOverride)
+
+	return rt
+}
+
+// clientErrorStatus picks the status code for an error of the client layer
+func clientErrorStatus(err error) int {
+	switch err.(type) {
+	case *client.InvalidSpecError, *client.InvalidRequestError:
+		return http.StatusBadRequest
+	case *client.QuotaExceededError:
+		return http.StatusForbidden
+	case *client.RuntimeExistsError, *client.LockBusyError:
+		return http.StatusConflict
+	}
+	if err == client.ErrReleaseNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// writeClientError responds with an error of the client layer
+func writeClientError(w http.ResponseWriter, err error) {
+	writeError(w, clientErrorStatus(err), err)
+}
+
+func listRuntimes(w http.ResponseWriter, r *http.Request) {
+	query, err := podQueryFromURL(r, k8s.NewRuntimeSelector())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	list, err := client.ListRuntimes(r.Context(), query)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createRuntime(w http.ResponseWriter, r *http.Request) {
+	var rs client.RuntimeSpec
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := client.CreateRuntime(rs, r.URL.Query().Get("timeout")); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	status, err := client.GetRuntimeStatus(r.Context(), rs.RuntimeId)
+	if err != nil {
+		log.Println(err)
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func getRuntime(w http.ResponseWriter, r *http.Request) {
+	status, err := client.GetRuntimeStatus(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if status.State == client.RuntimeStateMissing {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func deleteRuntime(w http.ResponseWriter, r *http.Request) {
+	dr, err := client.GetDeleteRequestFromRuntimeId(pathParam(r, "id"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := dr.Execute(r.URL.Query().Get("timeout")); err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listRuntimePods(w http.ResponseWriter, r *http.Request) {
+	query, err := podQueryFromURL(r, k8s.NewRuntimeSelector().Runtime(pathParam(r, "id")))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	pods, err := k8s.ListRuntimePods(r.Context(), query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pods)
+}
+
+func getRuntimeEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if l := query.Get("limit"); len(l) > 0 {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %s", l))
+			return
+		}
+		limit = n
+	}
+
+	events, err := k8s.GetRuntimeEvents(r.Context(), query.Get("namespace"), pathParam(r, "id"), query.Get("warningsOnly") == "true", limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	payload := struct {
+		Events []k8s.EventSummary `json:"events"`
+	}{Events: events}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func getRuntimeLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	query.Set("runtimeId", pathParam(r, "id"))
+	r.URL.RawQuery = query.Encode()
+	FetchRuntimeLogsHandler().ServeHTTP(w, r)
+}
+
+func getRuntimeMetrics(w http.ResponseWriter, r *http.Request) {
+	selector, err := k8s.NewRuntimeSelector().Runtime(pathParam(r, "id")).String()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	metrics, err := k8s.GetRuntimeMetrics(r.Context(), r.URL.Query().Get("namespace"), selector)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+func restartRuntime(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	strategy := client.RestartStrategy(query.Get("strategy"))
+
+	err := client.RestartRuntimeWithStrategy(pathParam(r, "id"), strategy, query.Get("timeout"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func upgradeRuntime(w http.ResponseWriter, r *http.Request) {
+	var upgrade client.RuntimeUpgrade
+	if err := json.NewDecoder(r.Body).Decode(&upgrade); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := client.UpgradeRuntime(pathParam(r, "id"), upgrade)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func rollbackRuntime(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	err := client.RollbackRuntime(pathParam(r, "id"), query.Get("revision"), query.Get("timeout"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func suspendRuntime(w http.ResponseWriter, r *http.Request) {
+	if err := client.SuspendRuntime(pathParam(r, "id")); err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func resumeRuntime(w http.ResponseWriter, r *http.Request) {
+	if err := client.ResumeRuntime(pathParam(r, "id"), r.URL.Query().Get("timeout")); err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listPods(w http.ResponseWriter, r *http.Request) {
+	query, err := podQueryFromURL(r, k8s.NewRuntimeSelector())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	pods, err := k8s.ListRuntimePods(r.Context(), query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pods)
+}
+
+func getPod(w http.ResponseWriter, r *http.Request) {
+	live := r.URL.Query().Get("live") == "true"
+	pod, err := k8s.GetRuntimePodByName(r.Context(), pathParam(r, "namespace"), pathParam(r, "name"), live)
+	if apierrors.IsNotFound(err) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pod)
+}
+
+func deleteRelease(w http.ResponseWriter, r *http.Request) {
+	dr := client.DeleteRequest{ReleaseName: pathParam(r, "name")}
+	if err := dr.Execute(r.URL.Query().Get("timeout")); err != nil {
+		writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func removeRepo(w http.ResponseWriter, r *http.Request) {
+	rr := client.RepoRemoveRequest{Repos: []string{pathParam(r, "name")}}
+	if err := rr.Execute(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getRollout(w http.ResponseWriter, r *http.Request) {
+	ro, ok := client.GetRollout(pathParam(r, "id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, ro)
+}
+
+func getQuota(w http.ResponseWriter, r *http.Request) {
+	quota, err := client.GetQuota(r.Context(), pathParam(r, "user"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quota)
+}
+
+func setReaperOverride(w http.ResponseWriter, r *http.Request) {
+	var override client.ReaperOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := client.SetReaperOverride(r.Context(), pathParam(r, "id"), &override); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, override)
+}
+
+func deleteReaperOverride(w http.ResponseWriter, r *http.Request) {
+	if err := client.SetReaperOverride(r.Context(), pathParam(r, "id"), nil); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+// WatchRuntimePodsHandler serves requests at /runtime/watch. Changes to
+// runtime pods are sent as Server-Sent Events, filtered by ?users=a,b and
+// ?namespace=. The event ID is the resourceVersion, so a reconnecting
+// EventSource resumes where it left off; ?resourceVersion= does the same.
+func WatchRuntimePodsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := k8s.PodFilter{Namespace: query.Get("namespace")}
+		if users := query.Get("users"); len(users) > 0 {
+			filter.Users = strings.Split(users, ",")
+		}
+
+		resourceVersion := r.Header.Get("Last-Event-ID")
+		if len(resourceVersion) == 0 {
+			resourceVersion = query.Get("resourceVersion")
+		}
+
+		ctx := r.Context()
+		events, err := k8s.WatchRuntimePods(ctx, filter, resourceVersion)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(30 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ResourceVersion, event.Type, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case <-ctx.Done():
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -1,13 +1,14 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
-	"strconv"
 	"strings"
-	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
 )
 
 // InstallRequest represents an install command
@@ -33,40 +34,47 @@ Flags:   %s
 	`, ir.ChartName, ir.ReleaseName, string(prettyValues), strings.Join(ir.Flags, " "))
 }
 
-func serializeValues(prefix string, values map[string]interface{}) []string {
-	result := []string{}
-
-	for key, val := range values {
-		fullKey := prefix + key
-		switch val.(type) {
-		case string:
-			result = append(result, fullKey+"="+val.(string))
-		case map[string]interface{}:
-			newPrefix := fullKey + "."
-			nestedVals := serializeValues(newPrefix, val.(map[string]interface{}))
-			result = append(result, nestedVals...)
+// Execute will install the chart as specified by the InstallRequest
+func (ir *InstallRequest) Execute() error {
+	if len(ir.ReleaseName) == 0 {
+		return fmt.Errorf("you cannot provide an empty release name")
+	}
+
+	owner := ownerOfValues(ir.Values)
+	if len(owner) > 0 {
+		unlockOwner, err := lockOwner(owner)
+		if err != nil {
+			return err
 		}
+		defer unlockOwner()
 	}
 
-	return result
-}
+	unlock, err := lockRelease(ir.ReleaseName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Only new releases count against the quota of their owner
+	if len(owner) > 0 {
+		_, err = getRelease(ir.ReleaseName)
+		if err == ErrReleaseNotFound {
+			err = checkQuota(context.Background(), owner, ir.Values)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-// GetValues flattens the values JSON and returns a slice of
-// key=value pairs
-func (ir *InstallRequest) GetValues() []string {
-	return serializeValues("", ir.Values)
+	return ir.install()
 }
 
-// Execute will install the chart as specified by the InstallRequest
-func (ir *InstallRequest) Execute() error {
+// install runs helm for the InstallRequest. The caller must hold
+// the lock of the release.
+func (ir *InstallRequest) install() error {
 	app := "helm"
 	args := []string{"upgrade", "-i", ir.ReleaseName, ir.ChartName}
 
-	// Constructing the --set argument
-	pac := ",podAnnotations.checksum=v" + strconv.FormatInt(time.Now().Unix(), 10)
-	values := []string{"--set", strings.Join(ir.GetValues(), ",") + pac}
-	args = append(args, values...)
-
 	// Checking release name is not empty
 	if len(ir.ReleaseName) == 0 {
 		return fmt.Errorf("you cannot provide an empty release name")
@@ -77,6 +85,14 @@ func (ir *InstallRequest) Execute() error {
 		return fmt.Errorf("you cannot provide an empty chart name")
 	}
 
+	// Secret references are resolved against the cluster here
+	values, cleanup, err := helmValuesArgs(ir.ReleaseName, ir.Values)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	args = append(args, values...)
+
 	flags := ir.Flags
 	if len(ir.PrivateChartsRepo) != 0 {
 		flags = append(flags, "--repo", ir.PrivateChartsRepo)
@@ -119,6 +135,12 @@ func (dr *DeleteRequest) Execute(timeout string) error {
 		return fmt.Errorf("you cannot provide an empty release name")
 	}
 
+	unlock, err := lockRelease(dr.ReleaseName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	log.Println("Uninstalling release:")
 	log.Println(dr.String())
 
@@ -133,7 +155,13 @@ func (dr *DeleteRequest) Execute(timeout string) error {
 	log.Println(args)
 	cmd := exec.Command(app, args...)
 
-	err := cmd.Run()
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	// The resolved secrets of the release go with it
+	err = k8s.DeleteSecret(context.Background(), "", releaseSecretName(dr.ReleaseName))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,265 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+)
+
+// Sources a pod query can be answered from
+const (
+	SourceCache = "cache"
+	SourceAPI   = "api"
+)
+
+// cacheContinuePrefix marks continue tokens issued by the cache, so they are
+// never sent to the API server (and API tokens never reach the cache)
+const cacheContinuePrefix = "cache:"
+
+// Freshness tells where a pod query was answered from and how recent the
+// data is
+type Freshness struct {
+	Source          string     `json:"source"`
+	ResourceVersion string     `json:"resourceVersion,omitempty"`
+	LastEventAt     *time.Time `json:"lastEventAt,omitempty"`
+}
+
+// PodQuery describes a list of runtime pods
+type PodQuery struct {
+	Namespace string
+	Selector  string
+	// FieldSelector selects on the fields listed in podFieldSelectorKeys
+	FieldSelector string
+	// CreatedAfter leaves out pods created before it. It is applied after
+	// paging when the API server is asked, so pages can come out short.
+	CreatedAfter *time.Time
+	Limit        int64
+	Continue     string
+	// SortBy is one of name (the default), createdAt or -createdAt
+	SortBy string
+	// Live skips the cache and asks the API server
+	Live bool
+}
+
+var (
+	lastPodEventMu sync.Mutex
+	lastPodEventAt time.Time
+)
+
+func recordPodEvent() {
+	lastPodEventMu.Lock()
+	lastPodEventAt = time.Now()
+	lastPodEventMu.Unlock()
+}
+
+// syncedPodLister returns a lister on the informer cache if it has synced
+func syncedPodLister() (listersv1.PodLister, Freshness, bool) {
+	informer, err := runtimePodInformer()
+	if err != nil || !informer.HasSynced() {
+		return nil, Freshness{}, false
+	}
+
+	freshness := Freshness{
+		Source:          SourceCache,
+		ResourceVersion: informer.LastSyncResourceVersion(),
+	}
+	lastPodEventMu.Lock()
+	if !lastPodEventAt.IsZero() {
+		at := lastPodEventAt
+		freshness.LastEventAt = &at
+	}
+	lastPodEventMu.Unlock()
+
+	return listersv1.NewPodLister(informer.GetIndexer()), freshness, true
+}
+
+// cursor is the position after the last pod of a page served from the cache
+type cursor struct {
+	SortBy    string    `json:"s"`
+	CreatedAt time.Time `json:"c"`
+	Namespace string    `json:"n"`
+	Name      string    `json:"p"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return cacheContinuePrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, cacheContinuePrefix))
+	if err != nil {
+		return c, fmt.Errorf("invalid continue token")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid continue token")
+	}
+	return c, nil
+}
+
+// podLess orders pods for the given sort key, falling back to
+// namespace/name so that the order is total
+func podLess(sortBy string, a cursor, b cursor) bool {
+	switch sortBy {
+	case "createdAt":
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	case "-createdAt":
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	}
+
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+func cursorOf(sortBy string, pod *v1.Pod) cursor {
+	return cursor{
+		SortBy:    sortBy,
+		CreatedAt: pod.CreationTimestamp.Time,
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+	}
+}
+
+// ListRuntimePods lists runtime pods from the informer cache, or from the API
+// server if the cache has not synced yet, Live is set, or the continue token
+// came from the API server
+func ListRuntimePods(ctx context.Context, query PodQuery) (PodListResult, error) {
+	switch query.SortBy {
+	case "", "name", "createdAt", "-createdAt":
+	default:
+		return PodListResult{}, fmt.Errorf("invalid sort key %s", query.SortBy)
+	}
+
+	fromCache := strings.HasPrefix(query.Continue, cacheContinuePrefix)
+	isAPIToken := len(query.Continue) > 0 && !fromCache
+
+	lister, freshness, synced := syncedPodLister()
+	if query.Live || isAPIToken || !synced {
+		if fromCache {
+			return PodListResult{}, fmt.Errorf("continue token is only valid while the pod cache is in use")
+		}
+		if len(query.SortBy) > 0 && query.SortBy != "name" {
+			return PodListResult{}, fmt.Errorf("sorting needs the pod cache, which is not in use")
+		}
+		result, err := GetPodsBySelector(ctx, query.Namespace, query.Selector, query.FieldSelector, query.Limit, query.Continue)
+		if err == nil && query.CreatedAfter != nil {
+			pods := make([]PodSummary, 0, len(result.Pods))
+			for _, pod := range result.Pods {
+				if !pod.CreatedAt.Time.Before(*query.CreatedAfter) {
+					pods = append(pods, pod)
+				}
+			}
+			result.Pods = pods
+		}
+		result.Freshness = &Freshness{Source: SourceAPI}
+		return result, err
+	}
+
+	selector, err := labels.Parse(query.Selector)
+	if err != nil {
+		return PodListResult{}, err
+	}
+
+	fieldSelector, err := fields.ParseSelector(query.FieldSelector)
+	if err != nil {
+		return PodListResult{}, err
+	}
+
+	var pods []*v1.Pod
+	if len(query.Namespace) > 0 {
+		pods, err = lister.Pods(query.Namespace).List(selector)
+	} else {
+		pods, err = lister.List(selector)
+	}
+	if err != nil {
+		return PodListResult{}, err
+	}
+
+	if !fieldSelector.Empty() || query.CreatedAfter != nil {
+		matching := pods[:0:0]
+		for _, pod := range pods {
+			if !fieldSelector.Matches(podFields(pod)) {
+				continue
+			}
+			if query.CreatedAfter != nil && pod.CreationTimestamp.Time.Before(*query.CreatedAfter) {
+				continue
+			}
+			matching = append(matching, pod)
+		}
+		pods = matching
+	}
+
+	sortBy := query.SortBy
+	sort.Slice(pods, func(i, j int) bool {
+		return podLess(sortBy, cursorOf(sortBy, pods[i]), cursorOf(sortBy, pods[j]))
+	})
+
+	start := 0
+	if fromCache {
+		after, err := decodeCursor(query.Continue)
+		if err != nil {
+			return PodListResult{}, err
+		}
+		if after.SortBy != sortBy {
+			return PodListResult{}, fmt.Errorf("continue token was issued for a different sort key")
+		}
+		start = sort.Search(len(pods), func(i int) bool {
+			return podLess(sortBy, after, cursorOf(sortBy, pods[i]))
+		})
+	}
+
+	end := len(pods)
+	if query.Limit > 0 && int64(end-start) > query.Limit {
+		end = start + int(query.Limit)
+	}
+
+	result := PodListResult{
+		Pods:      make([]PodSummary, 0, end-start),
+		Freshness: &freshness,
+	}
+	for _, pod := range pods[start:end] {
+		result.Pods = append(result.Pods, getSummaryFromPod(pod))
+	}
+	if end < len(pods) {
+		result.Continue = encodeCursor(cursorOf(sortBy, pods[end-1]))
+	}
+
+	return result, nil
+}
+
+// GetRuntimePodByName returns a runtime pod from the informer cache, going
+// to the API server if the cache has not synced or does not have the pod
+func GetRuntimePodByName(ctx context.Context, namespace string, name string, live bool) (PodDetailsResult, error) {
+	lister, freshness, synced := syncedPodLister()
+	if !live && synced && len(namespace) > 0 {
+		pod, err := lister.Pods(namespace).Get(name)
+		if err == nil {
+			return PodDetailsResult{
+				Details:   *pod.DeepCopy(),
+				Summary:   getSummaryFromPod(pod),
+				Freshness: &freshness,
+			}, nil
+		}
+	}
+
+	result, err := GetPodByName(ctx, namespace, name)
+	result.Freshness = &Freshness{Source: SourceAPI}
+	return result, err
+}
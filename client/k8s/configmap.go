@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"context"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// GetConfigMapData returns the data of a ConfigMap, or an empty map if it does
+// not exist. If namespace is empty, the namespace of the current kubeconfig
+// context is used.
+func GetConfigMapData(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := k8sClient.ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
+
+// SetConfigMapKey sets one key of a ConfigMap, creating the ConfigMap if
+// needed. An empty value removes the key.
+func SetConfigMapKey(ctx context.Context, namespace string, name string, key string, value string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	configMaps := k8sClient.ConfigMaps(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			if len(value) == 0 {
+				return nil
+			}
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Data:       map[string]string{key: value},
+			}
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				return errors.NewConflict(v1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if len(value) == 0 {
+			delete(cm.Data, key)
+		} else {
+			cm.Data[key] = value
+		}
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,175 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+type EventSummary struct {
+	Type       string      `json:"type"`
+	Reason     string      `json:"reason"`
+	Message    string      `json:"message"`
+	Count      int32       `json:"count"`
+	ObjectKind string      `json:"objectKind"`
+	ObjectName string      `json:"objectName"`
+	Source     string      `json:"source,omitempty"`
+	FirstSeen  metav1.Time `json:"firstSeen"`
+	LastSeen   metav1.Time `json:"lastSeen"`
+}
+
+type involvedObject struct {
+	kind string
+	name string
+}
+
+func getSummaryFromEvent(event *v1.Event) EventSummary {
+	lastSeen := event.LastTimestamp
+	if lastSeen.IsZero() {
+		lastSeen = metav1.NewTime(event.EventTime.Time)
+	}
+	if lastSeen.IsZero() {
+		lastSeen = event.CreationTimestamp
+	}
+
+	firstSeen := event.FirstTimestamp
+	if firstSeen.IsZero() {
+		firstSeen = lastSeen
+	}
+
+	count := event.Count
+	if count == 0 {
+		count = 1
+	}
+
+	source := event.Source.Component
+	if len(source) == 0 {
+		source = event.ReportingController
+	}
+
+	return EventSummary{
+		Type:       event.Type,
+		Reason:     event.Reason,
+		Message:    event.Message,
+		Count:      count,
+		ObjectKind: event.InvolvedObject.Kind,
+		ObjectName: event.InvolvedObject.Name,
+		Source:     source,
+		FirstSeen:  firstSeen,
+		LastSeen:   lastSeen,
+	}
+}
+
+// releaseObjects lists the workload objects of a runtime release that
+// events are usually reported against
+func releaseObjects(ctx context.Context, clientset kubernetes.Interface, namespace string, runtimeId string) ([]involvedObject, error) {
+	selector, err := new(SelectorBuilder).Runtime(runtimeId).String()
+	if err != nil {
+		return nil, err
+	}
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	objects := []involvedObject{}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		objects = append(objects, involvedObject{kind: "Pod", name: pod.Name})
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments.Items {
+		objects = append(objects, involvedObject{kind: "Deployment", name: deployment.Name})
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, replicaSet := range replicaSets.Items {
+		objects = append(objects, involvedObject{kind: "ReplicaSet", name: replicaSet.Name})
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		objects = append(objects, involvedObject{kind: "StatefulSet", name: statefulSet.Name})
+	}
+
+	claims, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, claim := range claims.Items {
+		objects = append(objects, involvedObject{kind: "PersistentVolumeClaim", name: claim.Name})
+	}
+
+	return objects, nil
+}
+
+// GetRuntimeEvents returns the events of the pods and workloads of a runtime,
+// oldest first. With warningsOnly set, Normal events are left out. If limit is
+// positive, only the most recent limit events are returned.
+func GetRuntimeEvents(ctx context.Context, namespace string, runtimeId string, warningsOnly bool, limit int) ([]EventSummary, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := releaseObjects(ctx, clientset, namespace, runtimeId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []EventSummary{}
+	for _, object := range objects {
+		selector := fields.Set{
+			"involvedObject.kind": object.kind,
+			"involvedObject.name": object.name,
+		}
+		if warningsOnly {
+			selector["type"] = v1.EventTypeWarning
+		}
+
+		events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: selector.AsSelector().String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range events.Items {
+			result = append(result, getSummaryFromEvent(&events.Items[i]))
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastSeen.Before(&result[j].LastSeen)
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+
+	return result, nil
+}
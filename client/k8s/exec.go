@@ -0,0 +1,168 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// TerminalSize is the size of the terminal of an exec session
+type TerminalSize struct {
+	Width  uint16 `json:"Width"`
+	Height uint16 `json:"Height"`
+}
+
+// resizeQueue adapts a channel of sizes to remotecommand.TerminalSizeQueue
+type resizeQueue <-chan TerminalSize
+
+func (q resizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q
+	if !ok {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: size.Width, Height: size.Height}
+}
+
+// ExecOptions describes a command to run in a pod
+type ExecOptions struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+	TTY       bool
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	// Resize receives the new size whenever the terminal is resized (TTY only)
+	Resize <-chan TerminalSize
+}
+
+// ExecInPod runs a command in a container of a pod and streams its
+// input and output until it exits
+func ExecInPod(opts ExecOptions) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	config, err := getRestConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := namespaceOrDefault(kubeconfig, opts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	req := k8sClient.RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(opts.Pod).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: opts.Container,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  opts.Stdin,
+		Stdout: opts.Stdout,
+		Tty:    opts.TTY,
+	}
+	if !opts.TTY {
+		streamOptions.Stderr = opts.Stderr
+	}
+	if opts.TTY && opts.Resize != nil {
+		streamOptions.TerminalSizeQueue = resizeQueue(opts.Resize)
+	}
+
+	return executor.Stream(streamOptions)
+}
+
+// portForwardConn is a connection to a port of a pod
+type portForwardConn struct {
+	io.ReadWriteCloser
+	conn interface{ Close() error }
+}
+
+func (c *portForwardConn) Close() error {
+	c.ReadWriteCloser.Close()
+	return c.conn.Close()
+}
+
+// DialPod opens a connection to a port of a pod through the API server, the
+// same way kubectl port-forward does. Closing it closes the tunnel.
+func DialPod(namespace string, pod string, port int) (io.ReadWriteCloser, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	config, err := getRestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	req := k8sClient.RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, strconv.Itoa(port))
+	headers.Set(v1.PortForwardRequestIDHeader, "0")
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Nothing is ever written to the error stream from this side
+	errorStream.Close()
+
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+	dataStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not open port %d of %s: %v", port, pod, err)
+	}
+
+	return &portForwardConn{ReadWriteCloser: dataStream, conn: conn}, nil
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// runtimePodSelector matches the pods of all user runtimes
+const runtimePodSelector = "mayaResourceType=userRuntime"
+
+var (
+	podInformer     cache.SharedIndexInformer
+	podInformerErr  error
+	podInformerOnce sync.Once
+)
+
+// runtimePodInformer returns the shared informer on runtime pods in all
+// namespaces, starting it the first time it is asked for
+func runtimePodInformer() (cache.SharedIndexInformer, error) {
+	podInformerOnce.Do(func() {
+		kubeconfig := os.Getenv("KUBECONFIG")
+		clientset, err := getClientset(kubeconfig)
+		if err != nil {
+			podInformerErr = err
+			return
+		}
+
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			clientset,
+			0,
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = runtimePodSelector
+			}),
+		)
+
+		podInformer = factory.Core().V1().Pods().Informer()
+		podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { podEvents.publish(PodAdded, obj) },
+			UpdateFunc: func(oldObj, obj interface{}) {
+				// Periodic relists report unchanged pods as updates
+				if oldObj.(*v1.Pod).ResourceVersion != obj.(*v1.Pod).ResourceVersion {
+					podEvents.publish(PodModified, obj)
+				}
+			},
+			DeleteFunc: func(obj interface{}) { podEvents.publish(PodDeleted, obj) },
+		})
+
+		// The informer lives as long as the process
+		factory.Start(make(chan struct{}))
+	})
+
+	if podInformerErr != nil {
+		return nil, fmt.Errorf("could not start runtime pod informer: %v", podInformerErr)
+	}
+	return podInformer, nil
+}
+
+// StartRuntimePodCache starts the informer on runtime pods ahead of the
+// first query, so the cache has a chance to sync before it is needed
+func StartRuntimePodCache() error {
+	_, err := runtimePodInformer()
+	return err
+}
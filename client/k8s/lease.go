@@ -0,0 +1,398 @@
+package k8s
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	coordv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// DefaultLeaseDuration is how long a lease stays valid without being renewed
+const DefaultLeaseDuration = 30 * time.Second
+
+// ErrLeaseHeld is returned when a lease is held by someone else
+type ErrLeaseHeld struct {
+	Name   string
+	Holder string
+}
+
+func (e *ErrLeaseHeld) Error() string {
+	return fmt.Sprintf("lease %s is held by %s", e.Name, e.Holder)
+}
+
+// LeaseManager hands out locks backed by coordination.k8s.io/v1 Lease
+// objects, so that they hold across all replicas of helmapi
+type LeaseManager struct {
+	leases   coordclient.LeaseInterface
+	identity string
+	duration time.Duration
+}
+
+// NewLeaseManager returns a LeaseManager that keeps its leases in the given
+// client. identity names this process as the holder of the leases.
+func NewLeaseManager(leases coordclient.LeaseInterface, identity string, duration time.Duration) *LeaseManager {
+	return &LeaseManager{
+		leases:   leases,
+		identity: identity,
+		duration: duration,
+	}
+}
+
+var (
+	defaultLeaseManager     *LeaseManager
+	defaultLeaseManagerErr  error
+	defaultLeaseManagerOnce sync.Once
+)
+
+// DefaultLeaseManager returns the LeaseManager for the cluster in KUBECONFIG,
+// keeping leases in the namespace of the current context
+func DefaultLeaseManager() (*LeaseManager, error) {
+	defaultLeaseManagerOnce.Do(func() {
+		kubeconfig := os.Getenv("KUBECONFIG")
+		clientset, err := getClientset(kubeconfig)
+		if err != nil {
+			defaultLeaseManagerErr = err
+			return
+		}
+
+		namespace, err := getDefaultNamespace(kubeconfig)
+		if err != nil {
+			defaultLeaseManagerErr = err
+			return
+		}
+
+		// Inside the cluster the hostname is the name of the pod
+		identity, err := os.Hostname()
+		if err != nil {
+			defaultLeaseManagerErr = err
+			return
+		}
+
+		defaultLeaseManager = NewLeaseManager(clientset.CoordinationV1().Leases(namespace), identity, DefaultLeaseDuration)
+	})
+
+	return defaultLeaseManager, defaultLeaseManagerErr
+}
+
+// Identity returns the name this process holds leases under
+func (lm *LeaseManager) Identity() string {
+	return lm.identity
+}
+
+// LeaseExpired tells whether the holder of a lease has stopped renewing it
+func LeaseExpired(lease *coordv1.Lease) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || len(*spec.HolderIdentity) == 0 {
+		return true
+	}
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+// Get returns the lease with the given name
+func (lm *LeaseManager) Get(ctx context.Context, name string) (*coordv1.Lease, error) {
+	return lm.leases.Get(ctx, name, metav1.GetOptions{})
+}
+
+// List returns the leases matching a label selector
+func (lm *LeaseManager) List(ctx context.Context, selector string) ([]coordv1.Lease, error) {
+	leases, err := lm.leases.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return leases.Items, nil
+}
+
+// Acquire takes the named lease if it does not exist, has been released or
+// has expired, and keeps renewing it in the background until the returned
+// Lock is released. It fails with *ErrLeaseHeld if someone else holds it.
+func (lm *LeaseManager) Acquire(ctx context.Context, name string, labels map[string]string) (*Lock, error) {
+	holder := lm.identity + "_" + randomSuffix()
+	durationSeconds := int32(lm.duration / time.Second)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := lm.leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		transitions := int32(0)
+		lease = &coordv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+			Spec: coordv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+				LeaseTransitions:     &transitions,
+			},
+		}
+		lease, err = lm.leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return nil, &ErrLeaseHeld{Name: name, Holder: "another replica"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return lm.newLock(lease), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !LeaseExpired(lease) {
+		return nil, &ErrLeaseHeld{Name: name, Holder: *lease.Spec.HolderIdentity}
+	}
+
+	if lease.Spec.HolderIdentity != nil && len(*lease.Spec.HolderIdentity) > 0 {
+		log.Println("Taking over expired lease", name, "from", *lease.Spec.HolderIdentity)
+	}
+
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseTransitions = &transitions
+	if lease.Labels == nil {
+		lease.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		lease.Labels[key] = value
+	}
+
+	// The update carries the resourceVersion we read, so if another replica
+	// took the lease in the meantime it fails with a conflict
+	lease, err = lm.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return nil, &ErrLeaseHeld{Name: name, Holder: "another replica"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return lm.newLock(lease), nil
+}
+
+// AcquireWait is Acquire, but while someone else holds the lease it keeps
+// trying, backing off up to a few seconds between tries, for at most wait.
+// It fails with *ErrLeaseHeld if the lease is still held after that.
+func (lm *LeaseManager) AcquireWait(ctx context.Context, name string, labels map[string]string, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+	backoff := 100 * time.Millisecond
+
+	for {
+		lock, err := lm.Acquire(ctx, name, labels)
+		if _, held := err.(*ErrLeaseHeld); !held {
+			return lock, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, err
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
+	}
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Lock is a lease held by this process
+type Lock struct {
+	lm     *LeaseManager
+	name   string
+	holder string
+
+	mu          sync.Mutex
+	lease       *coordv1.Lease
+	annotations map[string]string
+
+	stop     chan struct{}
+	lost     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+func (lm *LeaseManager) newLock(lease *coordv1.Lease) *Lock {
+	l := &Lock{
+		lm:          lm,
+		name:        lease.Name,
+		holder:      *lease.Spec.HolderIdentity,
+		lease:       lease,
+		annotations: map[string]string{},
+		stop:        make(chan struct{}),
+		lost:        make(chan struct{}),
+	}
+
+	l.done.Add(1)
+	go l.renew()
+
+	return l
+}
+
+// Lease returns the lease object as of its last renewal
+func (l *Lock) Lease() *coordv1.Lease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lease.DeepCopy()
+}
+
+// Lost is closed when the lease could not be renewed before it expired,
+// which means another replica may have taken it over
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// SetAnnotation stores a value on the lease. It is written with the next
+// renewal, or right away by Flush.
+func (l *Lock) SetAnnotation(key string, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.annotations[key] = value
+}
+
+// Flush writes the pending annotations and renews the lease
+func (l *Lock) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.update(ctx, false)
+}
+
+// update writes the lease back with a fresh renew time and the pending
+// annotations. release clears the holder. Must be called with l.mu held.
+func (l *Lock) update(ctx context.Context, release bool) error {
+	lease := l.lease.DeepCopy()
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	for key, value := range l.annotations {
+		lease.Annotations[key] = value
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	if release {
+		lease.Spec.HolderIdentity = nil
+	}
+
+	updated, err := l.lm.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// Someone else wrote the lease; only carry on if it is still ours
+		current, getErr := l.lm.leases.Get(ctx, l.name, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		if current.Spec.HolderIdentity == nil || *current.Spec.HolderIdentity != l.holder {
+			return &ErrLeaseHeld{Name: l.name, Holder: "another replica"}
+		}
+		l.lease = current
+		return l.update(ctx, release)
+	}
+	if err != nil {
+		return err
+	}
+
+	l.lease = updated
+	return nil
+}
+
+func (l *Lock) renew() {
+	defer l.done.Done()
+
+	ticker := time.NewTicker(l.lm.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.lm.duration/3)
+		l.mu.Lock()
+		err := l.update(ctx, false)
+		expired := LeaseExpired(l.lease)
+		l.mu.Unlock()
+		cancel()
+
+		if err == nil {
+			continue
+		}
+
+		log.Println("Could not renew lease", l.name, err)
+		if _, held := err.(*ErrLeaseHeld); held || expired {
+			close(l.lost)
+			return
+		}
+	}
+}
+
+func (l *Lock) stopRenewing() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	l.done.Wait()
+}
+
+// Release stops renewing the lease and gives it up, keeping the lease object
+// (and its annotations) around for others to read
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopRenewing()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.update(ctx, true)
+}
+
+// Delete stops renewing the lease and removes the lease object, as long as
+// it still belongs to this lock
+func (l *Lock) Delete(ctx context.Context) error {
+	l.stopRenewing()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	uid := l.lease.UID
+	resourceVersion := l.lease.ResourceVersion
+	err := l.lm.leases.Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaseManager(identity string) (*LeaseManager, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset()
+	return NewLeaseManager(clientset.CoordinationV1().Leases("default"), identity, DefaultLeaseDuration), clientset
+}
+
+func TestAcquireCreatesLease(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := newTestLeaseManager("replica-a")
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", map[string]string{"helmapi.mayahq.com/lock": "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Delete(ctx)
+
+	lease, err := lm.Get(ctx, "helmapi-release-rt-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != lock.holder {
+		t.Errorf("holder = %v, want %s", lease.Spec.HolderIdentity, lock.holder)
+	}
+	if lease.Labels["helmapi.mayahq.com/lock"] != "release" {
+		t.Errorf("labels = %v, want the lock label", lease.Labels)
+	}
+	if LeaseExpired(lease) {
+		t.Error("a freshly acquired lease should not be expired")
+	}
+}
+
+func TestAcquireHeld(t *testing.T) {
+	ctx := context.Background()
+	lm, clientset := newTestLeaseManager("replica-a")
+	other := NewLeaseManager(clientset.CoordinationV1().Leases("default"), "replica-b", DefaultLeaseDuration)
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Delete(ctx)
+
+	_, err = other.Acquire(ctx, "helmapi-release-rt-1", nil)
+	held, ok := err.(*ErrLeaseHeld)
+	if !ok {
+		t.Fatalf("err = %v, want *ErrLeaseHeld", err)
+	}
+	if held.Holder != lock.holder {
+		t.Errorf("holder = %s, want %s", held.Holder, lock.holder)
+	}
+}
+
+func TestAcquireTakesOverExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	lm, clientset := newTestLeaseManager("replica-b")
+
+	// A lease left behind by a replica that died a minute ago
+	holder := "replica-a_dead"
+	duration := int32(30)
+	transitions := int32(0)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	_, err := clientset.CoordinationV1().Leases("default").Create(ctx, &coordv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "helmapi-release-rt-1"},
+		Spec: coordv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+			LeaseTransitions:     &transitions,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Delete(ctx)
+
+	lease := lock.Lease()
+	if *lease.Spec.HolderIdentity == holder {
+		t.Error("expired lease was not taken over")
+	}
+	if *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("transitions = %d, want 1", *lease.Spec.LeaseTransitions)
+	}
+}
+
+func TestReleaseLetsOthersAcquire(t *testing.T) {
+	ctx := context.Background()
+	lm, clientset := newTestLeaseManager("replica-a")
+	other := NewLeaseManager(clientset.CoordinationV1().Leases("default"), "replica-b", DefaultLeaseDuration)
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lease, err := lm.Get(ctx, "helmapi-release-rt-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !LeaseExpired(lease) {
+		t.Error("a released lease should count as expired")
+	}
+
+	next, err := other.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	defer next.Delete(ctx)
+}
+
+func TestDeleteRemovesLease(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := newTestLeaseManager("replica-a")
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	leases, err := lm.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 0 {
+		t.Errorf("got %d leases after delete, want none", len(leases))
+	}
+}
+
+func TestAnnotationPersistsAfterRelease(t *testing.T) {
+	ctx := context.Background()
+	lm, _ := newTestLeaseManager("replica-a")
+
+	lock, err := lm.Acquire(ctx, "helmapi-rollout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.SetAnnotation("helmapi.mayahq.com/rollout", `{"done":["rt-1"]}`)
+	if err := lock.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lease, err := lm.Get(ctx, "helmapi-rollout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lease.Annotations["helmapi.mayahq.com/rollout"]; got != `{"done":["rt-1"]}` {
+		t.Errorf("annotation after flush = %q", got)
+	}
+
+	// A rollout that is resumed elsewhere reads its progress from the
+	// released lease
+	lock.SetAnnotation("helmapi.mayahq.com/rollout", `{"done":["rt-1","rt-2"]}`)
+	if err := lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lease, err = lm.Get(ctx, "helmapi-rollout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lease.Annotations["helmapi.mayahq.com/rollout"]; got != `{"done":["rt-1","rt-2"]}` {
+		t.Errorf("annotation after release = %q", got)
+	}
+}
+
+func TestAcquireWait(t *testing.T) {
+	ctx := context.Background()
+	lm, clientset := newTestLeaseManager("replica-a")
+	other := NewLeaseManager(clientset.CoordinationV1().Leases("default"), "replica-b", DefaultLeaseDuration)
+
+	lock, err := lm.Acquire(ctx, "helmapi-release-rt-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Still held when the wait runs out
+	_, err = other.AcquireWait(ctx, "helmapi-release-rt-1", nil, 300*time.Millisecond)
+	if _, held := err.(*ErrLeaseHeld); !held {
+		t.Fatalf("err = %v, want *ErrLeaseHeld", err)
+	}
+
+	// Given up while waiting
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock.Delete(ctx)
+	}()
+	next, err := other.AcquireWait(ctx, "helmapi-release-rt-1", nil, 10*time.Second)
+	if err != nil {
+		t.Fatalf("acquire while waiting: %v", err)
+	}
+	next.Delete(ctx)
+}
@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// LogOptions selects which logs of a pod to fetch
+type LogOptions struct {
+	Container    string
+	TailLines    *int64
+	SinceSeconds *int64
+	Previous     bool
+	Follow       bool
+	Timestamps   bool
+}
+
+// ResolveRuntimePod returns the name of the pod of a runtime, preferring
+// running pods and, among those, the most recently created one
+func ResolveRuntimePod(ctx context.Context, namespace string, runtimeId string) (string, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	selector, err := NewRuntimeSelector().Owned().Runtime(runtimeId).String()
+	if err != nil {
+		return "", err
+	}
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	pods, err := k8sClient.Pods(namespace).List(ctx, listOptions)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no pods found for runtime %s", runtimeId)
+	}
+
+	items := pods.Items
+	sort.Slice(items, func(i, j int) bool {
+		iRunning := items[i].Status.Phase == v1.PodRunning
+		jRunning := items[j].Status.Phase == v1.PodRunning
+		if iRunning != jRunning {
+			return iRunning
+		}
+		return items[j].CreationTimestamp.Before(&items[i].CreationTimestamp)
+	})
+
+	return items[0].Name, nil
+}
+
+// RuntimePod returns the pod of a runtime to read logs from or exec into.
+// Without a name the pod is resolved from runtimeId. A named pod must be a
+// runtime pod with an owner, and the pod of runtimeId if that is given too,
+// so that callers cannot reach arbitrary pods of the cluster.
+func RuntimePod(ctx context.Context, namespace string, runtimeId string, name string) (string, error) {
+	if len(name) == 0 {
+		return ResolveRuntimePod(ctx, namespace, runtimeId)
+	}
+
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	b := NewRuntimeSelector().Owned()
+	if len(runtimeId) > 0 {
+		b = b.Runtime(runtimeId)
+	}
+	selector, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+
+	pod, err := k8sClient.Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if !selector.Matches(labels.Set(pod.Labels)) {
+		return "", fmt.Errorf("pod %s is not a runtime pod", name)
+	}
+
+	return pod.Name, nil
+}
+
+// StreamPodLogs opens the log stream of a pod. The caller must close it.
+func StreamPodLogs(ctx context.Context, namespace string, name string, opts LogOptions) (io.ReadCloser, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	logOptions := &v1.PodLogOptions{
+		Container:    opts.Container,
+		TailLines:    opts.TailLines,
+		SinceSeconds: opts.SinceSeconds,
+		Previous:     opts.Previous,
+		Follow:       opts.Follow,
+		Timestamps:   opts.Timestamps,
+	}
+
+	return k8sClient.Pods(namespace).GetLogs(name, logOptions).Stream(ctx)
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+	typemetrics "k8s.io/metrics/pkg/client/clientset/versioned/typed/metrics/v1beta1"
+)
+
+// metricsClientFor returns a client of the metrics.k8s.io API. Tests can
+// replace it to return the client of a fake metrics clientset.
+var metricsClientFor = func(configLocation string) (typemetrics.MetricsV1beta1Interface, error) {
+	config, err := getRestConfig(configLocation)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := metricsclient.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return clientset.MetricsV1beta1(), nil
+}
+
+// Usage is the CPU and memory used by a container, a pod or a user. CPU and
+// Memory are Kubernetes quantities, CPUMillis and MemoryBytes the same values
+// as numbers for charts and sums.
+type Usage struct {
+	CPU         string `json:"cpu"`
+	Memory      string `json:"memory"`
+	CPUMillis   int64  `json:"cpuMillis"`
+	MemoryBytes int64  `json:"memoryBytes"`
+}
+
+type ContainerUsage struct {
+	Name string `json:"name"`
+	Usage
+}
+
+type PodUsage struct {
+	Name       string           `json:"name"`
+	Namespace  string           `json:"namespace"`
+	RuntimeId  string           `json:"runtimeId"`
+	OwnerId    string           `json:"ownerId"`
+	Timestamp  metav1.Time      `json:"timestamp"`
+	Window     string           `json:"window"`
+	Containers []ContainerUsage `json:"containers"`
+	Usage
+}
+
+type UserUsage struct {
+	OwnerId string `json:"ownerId"`
+	Pods    int    `json:"pods"`
+	Usage
+}
+
+type RuntimeMetricsResult struct {
+	Pods  []PodUsage  `json:"pods"`
+	Users []UserUsage `json:"users"`
+}
+
+func newUsage(cpu *resource.Quantity, memory *resource.Quantity) Usage {
+	return Usage{
+		CPU:         cpu.String(),
+		Memory:      memory.String(),
+		CPUMillis:   cpu.MilliValue(),
+		MemoryBytes: memory.Value(),
+	}
+}
+
+func getUsageFromPodMetrics(pm *metricsv1beta1.PodMetrics) PodUsage {
+	podCPU := resource.Quantity{}
+	podMemory := resource.Quantity{}
+
+	containers := make([]ContainerUsage, 0, len(pm.Containers))
+	for _, c := range pm.Containers {
+		cpu := c.Usage[v1.ResourceCPU]
+		memory := c.Usage[v1.ResourceMemory]
+		podCPU.Add(cpu)
+		podMemory.Add(memory)
+		containers = append(containers, ContainerUsage{Name: c.Name, Usage: newUsage(&cpu, &memory)})
+	}
+
+	return PodUsage{
+		Name:       pm.Name,
+		Namespace:  pm.Namespace,
+		RuntimeId:  strings.TrimPrefix(pm.Labels["app.kubernetes.io/instance"], "rt-"),
+		OwnerId:    pm.Labels["userRuntimeOwner"],
+		Timestamp:  pm.Timestamp,
+		Window:     pm.Window.Duration.String(),
+		Containers: containers,
+		Usage:      newUsage(&podCPU, &podMemory),
+	}
+}
+
+// aggregateByUser sums the usage of the pods of every owner
+func aggregateByUser(pods []PodUsage) []UserUsage {
+	type total struct {
+		pods   int
+		cpu    resource.Quantity
+		memory resource.Quantity
+	}
+
+	totals := make(map[string]*total)
+	owners := []string{}
+	for _, pod := range pods {
+		t, ok := totals[pod.OwnerId]
+		if !ok {
+			t = &total{}
+			totals[pod.OwnerId] = t
+			owners = append(owners, pod.OwnerId)
+		}
+		t.pods++
+		t.cpu.Add(*resource.NewMilliQuantity(pod.CPUMillis, resource.DecimalSI))
+		t.memory.Add(*resource.NewQuantity(pod.MemoryBytes, resource.BinarySI))
+	}
+	sort.Strings(owners)
+
+	users := make([]UserUsage, 0, len(owners))
+	for _, owner := range owners {
+		t := totals[owner]
+		users = append(users, UserUsage{OwnerId: owner, Pods: t.pods, Usage: newUsage(&t.cpu, &t.memory)})
+	}
+	return users
+}
+
+func getRuntimeMetrics(ctx context.Context, metrics typemetrics.MetricsV1beta1Interface, namespace string, selector string) (RuntimeMetricsResult, error) {
+	list, err := metrics.PodMetricses(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return RuntimeMetricsResult{}, err
+	}
+
+	pods := make([]PodUsage, 0, len(list.Items))
+	for i := range list.Items {
+		pods = append(pods, getUsageFromPodMetrics(&list.Items[i]))
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	return RuntimeMetricsResult{Pods: pods, Users: aggregateByUser(pods)}, nil
+}
+
+// GetRuntimeMetrics returns the current CPU and memory usage of the runtime
+// pods matching selector, per pod and container, along with the totals of
+// every owner. An empty namespace means all namespaces. The numbers come from
+// the metrics.k8s.io API, so metrics-server has to be running.
+func GetRuntimeMetrics(ctx context.Context, namespace string, selector string) (RuntimeMetricsResult, error) {
+	metrics, err := metricsClientFor(os.Getenv("KUBECONFIG"))
+	if err != nil {
+		return RuntimeMetricsResult{}, err
+	}
+
+	return getRuntimeMetrics(ctx, metrics, namespace, selector)
+}
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func podMetrics(namespace string, name string, labels map[string]string, usage ...v1.ResourceList) *metricsv1beta1.PodMetrics {
+	pm := &metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Timestamp:  metav1.NewTime(time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)),
+		Window:     metav1.Duration{Duration: 30 * time.Second},
+	}
+	for i, u := range usage {
+		pm.Containers = append(pm.Containers, metricsv1beta1.ContainerMetrics{Name: []string{"runtime", "sidecar"}[i], Usage: u})
+	}
+	return pm
+}
+
+func cpuMemory(cpu string, memory string) v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse(cpu),
+		v1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+func runtimeLabels(runtimeId string, owner string) map[string]string {
+	return map[string]string{
+		"mayaResourceType":           "userRuntime",
+		"app.kubernetes.io/instance": "rt-" + runtimeId,
+		"userRuntimeOwner":           owner,
+	}
+}
+
+func TestGetRuntimeMetrics(t *testing.T) {
+	// The fake clientset lists pod metrics as "pods", while objects given to
+	// NewSimpleClientset would be stored as "podmetricses"
+	clientset := fake.NewSimpleClientset()
+	gvr := schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	for _, pm := range []*metricsv1beta1.PodMetrics{
+		podMetrics("runtimes", "rt-b-0", runtimeLabels("b", "alice"), cpuMemory("250m", "128Mi"), cpuMemory("50m", "32Mi")),
+		podMetrics("runtimes", "rt-a-0", runtimeLabels("a", "alice"), cpuMemory("100m", "64Mi")),
+		podMetrics("runtimes", "rt-c-0", runtimeLabels("c", "bob"), cpuMemory("1", "1Gi")),
+		podMetrics("runtimes", "rt-d-0", runtimeLabels("d", "carol"), cpuMemory("2", "2Gi")),
+		podMetrics("runtimes", "helmapi-0", map[string]string{"app": "helmapi"}, cpuMemory("10m", "16Mi")),
+	} {
+		if err := clientset.Tracker().Create(gvr, pm, pm.Namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	selector, err := NewRuntimeSelector().Owners("alice", "bob").String()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := getRuntimeMetrics(context.Background(), clientset.MetricsV1beta1(), "", selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPods := []struct {
+		name      string
+		runtimeId string
+		ownerId   string
+		cpuMillis int64
+		memory    int64
+		container int
+	}{
+		{"rt-a-0", "a", "alice", 100, 64 << 20, 1},
+		{"rt-b-0", "b", "alice", 300, 160 << 20, 2},
+		{"rt-c-0", "c", "bob", 1000, 1 << 30, 1},
+	}
+	if len(result.Pods) != len(wantPods) {
+		t.Fatalf("got %d pods, want %d: %+v", len(result.Pods), len(wantPods), result.Pods)
+	}
+	for i, want := range wantPods {
+		got := result.Pods[i]
+		if got.Name != want.name || got.RuntimeId != want.runtimeId || got.OwnerId != want.ownerId {
+			t.Errorf("pod %d = %s/%s/%s, want %s/%s/%s", i, got.Name, got.RuntimeId, got.OwnerId, want.name, want.runtimeId, want.ownerId)
+		}
+		if got.CPUMillis != want.cpuMillis || got.MemoryBytes != want.memory {
+			t.Errorf("usage of %s = %dm %d bytes, want %dm %d bytes", got.Name, got.CPUMillis, got.MemoryBytes, want.cpuMillis, want.memory)
+		}
+		if len(got.Containers) != want.container {
+			t.Errorf("%s has %d containers, want %d", got.Name, len(got.Containers), want.container)
+		}
+		if got.Window != "30s" {
+			t.Errorf("window of %s = %s, want 30s", got.Name, got.Window)
+		}
+	}
+
+	wantUsers := []UserUsage{
+		{OwnerId: "alice", Pods: 2, Usage: Usage{CPU: "400m", Memory: "224Mi", CPUMillis: 400, MemoryBytes: 224 << 20}},
+		{OwnerId: "bob", Pods: 1, Usage: Usage{CPU: "1", Memory: "1Gi", CPUMillis: 1000, MemoryBytes: 1 << 30}},
+	}
+	if len(result.Users) != len(wantUsers) {
+		t.Fatalf("got %d users, want %d: %+v", len(result.Users), len(wantUsers), result.Users)
+	}
+	for i, want := range wantUsers {
+		if result.Users[i] != want {
+			t.Errorf("user %d = %+v, want %+v", i, result.Users[i], want)
+		}
+	}
+}
+
+func TestRuntimeMetricsSelectorRejectsInjection(t *testing.T) {
+	// An owner trying to widen the selector must not become a term of it
+	_, err := NewRuntimeSelector().Owners("alice),userRuntimeOwner notin (x").String()
+	if err == nil {
+		t.Fatal("expected an invalid owner to be rejected")
+	}
+}
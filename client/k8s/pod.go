@@ -5,82 +5,140 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 type PodSummary struct {
-	Name      string      `json:"name"`
-	Namespace string      `json:"namespace"`
-	Uid       string      `json:"uid"`
-	CreatedAt metav1.Time `json:"createdAt"`
-	OwnerId   string      `json:"ownerId"`
-	Node      string      `json:"node"`
-	Status    string      `json:"status"`
-	HostIP    string      `json:"hostIP"`
-	PodIP     string      `json:"podIP"`
-	StartTime metav1.Time `json:"startTime"`
+	Name                  string                `json:"name"`
+	Namespace             string                `json:"namespace"`
+	Uid                   string                `json:"uid"`
+	CreatedAt             metav1.Time           `json:"createdAt"`
+	OwnerId               string                `json:"ownerId"`
+	RuntimeId             string                `json:"runtimeId"`
+	Node                  string                `json:"node"`
+	Status                string                `json:"status"`
+	StatusReason          string                `json:"statusReason,omitempty"`
+	Ready                 bool                  `json:"ready"`
+	Terminating           bool                  `json:"terminating"`
+	RestartCount          int32                 `json:"restartCount"`
+	LastTerminationReason string                `json:"lastTerminationReason,omitempty"`
+	HostIP                string                `json:"hostIP"`
+	PodIP                 string                `json:"podIP"`
+	StartTime             metav1.Time           `json:"startTime"`
+	Conditions            []PodConditionSummary `json:"conditions"`
+	InitContainers        []ContainerSummary    `json:"initContainers,omitempty"`
+	Containers            []ContainerSummary    `json:"containers"`
+	LastActivity          *time.Time            `json:"lastActivity,omitempty"`
 }
 
+// LastActivityAnnotation can be set on runtime pods (RFC 3339) by whatever
+// sees their traffic, to tell when the runtime was last used
+const LastActivityAnnotation = "helmapi.mayahq.com/last-activity"
+
 type PodListResult struct {
-	Pods     []PodSummary `json:"pods"`
-	Continue string       `json:"continue"`
+	Pods      []PodSummary `json:"pods"`
+	Continue  string       `json:"continue"`
+	Freshness *Freshness   `json:"freshness,omitempty"`
 }
 
 type PodDetailsResult struct {
-	Details v1.Pod     `json:"details"`
-	Summary PodSummary `json:"summary"`
+	Details   v1.Pod     `json:"details"`
+	Summary   PodSummary `json:"summary"`
+	Freshness *Freshness `json:"freshness,omitempty"`
 }
 
-func convertMapToQueryString(mapToConv map[string]string) string {
-	expressions := make([]string, len(mapToConv))
-
-	i := 0
-	for key, value := range mapToConv {
-		expressions[i] = key + "=" + value
-	}
-
-	return strings.Join(expressions, ",")
+func getRestConfig(configLocation string) (*rest.Config, error) {
+	kubeconfig := filepath.Clean(configLocation)
+	return clientcmd.BuildConfigFromFlags("", kubeconfig)
 }
 
-func getClient(configLocation string) (typev1.CoreV1Interface, error) {
-	kubeconfig := filepath.Clean(configLocation)
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func getClientset(configLocation string) (kubernetes.Interface, error) {
+	config, err := getRestConfig(configLocation)
 	if err != nil {
 		return nil, err
 	}
-	clientset, err := kubernetes.NewForConfig(config)
+	return kubernetes.NewForConfig(config)
+}
+
+func getClient(configLocation string) (typev1.CoreV1Interface, error) {
+	clientset, err := getClientset(configLocation)
 	if err != nil {
 		return nil, err
 	}
 	return clientset.CoreV1(), nil
 }
 
+func getDefaultNamespace(configLocation string) (string, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: filepath.Clean(configLocation)}
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	namespace, _, err := config.Namespace()
+	return namespace, err
+}
+
+// namespaceOrDefault returns namespace, or the namespace of the current
+// kubeconfig context (which helm installs releases into) if it is empty
+func namespaceOrDefault(configLocation string, namespace string) (string, error) {
+	if len(namespace) > 0 {
+		return namespace, nil
+	}
+	return getDefaultNamespace(configLocation)
+}
+
 func getSummaryFromPod(pod *v1.Pod) PodSummary {
 	meta := pod.ObjectMeta
 	spec := pod.Spec
 	status := pod.Status
 
+	containers := summarizeContainers(spec.Containers, status.ContainerStatuses)
+	initContainers := summarizeContainers(spec.InitContainers, status.InitContainerStatuses)
+
 	var startTime metav1.Time
-	if len(status.ContainerStatuses) > 0 {
+	if len(status.ContainerStatuses) > 0 && status.ContainerStatuses[0].State.Running != nil {
 		startTime = status.ContainerStatuses[0].State.Running.StartedAt
 	}
 
+	var restartCount int32
+	var lastTerminationReason string
+	for _, container := range containers {
+		restartCount += container.RestartCount
+		if len(container.LastTerminationReason) > 0 {
+			lastTerminationReason = container.LastTerminationReason
+		}
+	}
+
+	var lastActivity *time.Time
+	if at, err := time.Parse(time.RFC3339, meta.Annotations[LastActivityAnnotation]); err == nil {
+		lastActivity = &at
+	}
+
 	return PodSummary{
-		Name:      meta.Name,
-		Namespace: meta.Namespace,
-		Uid:       string(meta.UID),
-		CreatedAt: meta.CreationTimestamp,
-		OwnerId:   meta.Labels["userRuntimeOwner"],
-		Node:      spec.NodeName,
-		Status:    string(status.Phase),
-		HostIP:    status.HostIP,
-		PodIP:     status.PodIP,
-		StartTime: startTime,
+		Name:                  meta.Name,
+		Namespace:             meta.Namespace,
+		Uid:                   string(meta.UID),
+		CreatedAt:             meta.CreationTimestamp,
+		OwnerId:               meta.Labels["userRuntimeOwner"],
+		RuntimeId:             strings.TrimPrefix(meta.Labels["app.kubernetes.io/instance"], "rt-"),
+		Node:                  spec.NodeName,
+		Status:                string(status.Phase),
+		StatusReason:          podStatusReason(pod, containers, initContainers),
+		Ready:                 isPodReady(pod),
+		Terminating:           meta.DeletionTimestamp != nil,
+		RestartCount:          restartCount,
+		LastTerminationReason: lastTerminationReason,
+		HostIP:                status.HostIP,
+		PodIP:                 status.PodIP,
+		StartTime:             startTime,
+		Conditions:            summarizeConditions(status.Conditions),
+		InitContainers:        initContainers,
+		Containers:            containers,
+		LastActivity:          lastActivity,
 	}
 }
 
@@ -88,6 +146,7 @@ func GetPodsBySelector(
 	ctx context.Context,
 	namespace string,
 	selector string,
+	fieldSelector string,
 	limit int64,
 	cont string,
 ) (
@@ -101,13 +160,14 @@ func GetPodsBySelector(
 
 	listOptions := metav1.ListOptions{
 		LabelSelector: selector,
+		FieldSelector: fieldSelector,
 		Limit:         limit,
 		Continue:      cont,
 	}
 
 	pods, perr := k8sClient.Pods(namespace).List(ctx, listOptions)
 	if perr != nil {
-		return PodListResult{}, err
+		return PodListResult{}, perr
 	}
 
 	result := make([]PodSummary, len(pods.Items))
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout
+// restart sets; changing it makes the workload replace its pods
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// RolloutRestartRuntime replaces the pods of a runtime the way kubectl
+// rollout restart does, by patching the pod template of its Deployments and
+// StatefulSets. It does not wait for the new pods.
+func RolloutRestartRuntime(ctx context.Context, namespace string, runtimeId string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339))
+
+	workloads, err := runtimeWorkloads(ctx, clientset, namespace, runtimeId)
+	if err != nil {
+		return err
+	}
+
+	if len(workloads) == 0 {
+		return fmt.Errorf("no workloads found for runtime %s", runtimeId)
+	}
+
+	for _, w := range workloads {
+		if err := w.patch(ctx, types.StrategicMergePatchType, []byte(patch)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteRuntimePods deletes the pods of a runtime so that their
+// controllers recreate them. It does not wait for the new pods.
+func DeleteRuntimePods(ctx context.Context, namespace string, runtimeId string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	selector, err := RuntimeSelector(runtimeId)
+	if err != nil {
+		return err
+	}
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	pods, err := k8sClient.Pods(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no pods found for runtime %s", runtimeId)
+	}
+
+	for _, pod := range pods.Items {
+		err := k8sClient.Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// RuntimeSelector returns the label selector matching the pods
+// that belong to the rt-<runtimeId> release
+func RuntimeSelector(runtimeId string) (string, error) {
+	return NewRuntimeSelector().Runtime(runtimeId).String()
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// runtimePodsReady tells whether there is at least one pod, and every pod
+// was created at or after since and is ready
+func runtimePodsReady(objs []interface{}, since time.Time) bool {
+	if len(objs) == 0 {
+		return false
+	}
+
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return false
+		}
+		if pod.CreationTimestamp.Time.Before(since) || !isPodReady(pod) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WaitForRuntimeReady blocks until the runtime has at least one pod and all
+// of its pods are ready, or until ctx is done. If namespace is empty, the
+// namespace of the current kubeconfig context is used.
+func WaitForRuntimeReady(ctx context.Context, namespace string, runtimeId string) error {
+	return WaitForRuntimeReplaced(ctx, namespace, runtimeId, time.Time{})
+}
+
+// WaitForRuntimeReplaced is like WaitForRuntimeReady, but also waits for
+// every pod created before since to be gone. Pods are followed with a watch.
+func WaitForRuntimeReplaced(ctx context.Context, namespace string, runtimeId string, since time.Time) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	// Creation timestamps only have a precision of seconds
+	since = since.Truncate(time.Second)
+
+	selector, err := RuntimeSelector(runtimeId)
+	if err != nil {
+		return err
+	}
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return k8sClient.Pods(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return k8sClient.Pods(namespace).Watch(ctx, options)
+		},
+	}
+
+	var store cache.Store
+	_, err = watchtools.UntilWithSync(ctx, lw, &v1.Pod{},
+		func(s cache.Store) (bool, error) {
+			store = s
+			return runtimePodsReady(store.List(), since), nil
+		},
+		func(event watch.Event) (bool, error) {
+			return runtimePodsReady(store.List(), since), nil
+		},
+	)
+
+	return err
+}
@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetSecretValue returns the value stored under key in the named Secret. If
+// namespace is empty, the namespace of the current kubeconfig context is used,
+// which is the same namespace helm installs releases into.
+func GetSecretValue(ctx context.Context, namespace string, name string, key string) (string, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := k8sClient.Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", key, namespace, name)
+	}
+
+	return string(value), nil
+}
+
+// ApplySecret creates the named Secret with the given labels and data, or
+// replaces the labels and data of the Secret if it already exists. If
+// namespace is empty, the namespace of the current kubeconfig context is used.
+func ApplySecret(ctx context.Context, namespace string, name string, labels map[string]string, data map[string][]byte) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	secrets := k8sClient.Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Type:       v1.SecretTypeOpaque,
+			Data:       data,
+		}
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	secret.Labels = labels
+	secret.Data = data
+	secret.StringData = nil
+	_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// DeleteSecret deletes the named Secret. A Secret that does not exist is
+// not an error. If namespace is empty, the namespace of the current
+// kubeconfig context is used.
+func DeleteSecret(ctx context.Context, namespace string, name string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	k8sClient, err := getClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	err = k8sClient.Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
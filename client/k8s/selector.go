@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// podFieldSelectorKeys are the pod fields the API server can select on,
+// and that the cache knows how to match
+var podFieldSelectorKeys = map[string]bool{
+	"metadata.name":            true,
+	"metadata.namespace":       true,
+	"spec.nodeName":            true,
+	"spec.restartPolicy":       true,
+	"spec.schedulerName":       true,
+	"spec.serviceAccountName":  true,
+	"status.phase":             true,
+	"status.podIP":             true,
+	"status.nominatedNodeName": true,
+}
+
+// SelectorBuilder builds a label selector over runtime pods out of typed
+// requirements. Keys and values are validated, so values coming from
+// requests cannot add terms of their own. The first error is kept and
+// returned by Build.
+type SelectorBuilder struct {
+	requirements []labels.Requirement
+	err          error
+}
+
+// NewRuntimeSelector starts a selector matching every runtime pod
+func NewRuntimeSelector() *SelectorBuilder {
+	return new(SelectorBuilder).Equals("mayaResourceType", "userRuntime")
+}
+
+func (b *SelectorBuilder) add(key string, op selection.Operator, values []string) *SelectorBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	r, err := labels.NewRequirement(key, op, values)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.requirements = append(b.requirements, *r)
+	return b
+}
+
+// Equals requires label key to have the given value
+func (b *SelectorBuilder) Equals(key string, value string) *SelectorBuilder {
+	return b.add(key, selection.Equals, []string{value})
+}
+
+// In requires label key to have one of the given values. No values
+// is left out of the selector rather than matching nothing.
+func (b *SelectorBuilder) In(key string, values ...string) *SelectorBuilder {
+	if len(values) == 0 {
+		return b
+	}
+	return b.add(key, selection.In, values)
+}
+
+// Without requires label key not to be set
+func (b *SelectorBuilder) Without(key string) *SelectorBuilder {
+	return b.add(key, selection.DoesNotExist, nil)
+}
+
+// Exists requires label key to be set, to any value
+func (b *SelectorBuilder) Exists(key string) *SelectorBuilder {
+	return b.add(key, selection.Exists, nil)
+}
+
+// Owned requires the pods to belong to a user
+func (b *SelectorBuilder) Owned() *SelectorBuilder {
+	return b.Exists("userRuntimeOwner")
+}
+
+// Owners restricts the selector to the pods of the given users
+func (b *SelectorBuilder) Owners(users ...string) *SelectorBuilder {
+	return b.In("userRuntimeOwner", users...)
+}
+
+// Runtime restricts the selector to the pods of one runtime
+func (b *SelectorBuilder) Runtime(runtimeId string) *SelectorBuilder {
+	return b.Equals("app.kubernetes.io/instance", "rt-"+runtimeId)
+}
+
+// Matching adds one equality requirement per label
+func (b *SelectorBuilder) Matching(match map[string]string) *SelectorBuilder {
+	for key, value := range match {
+		b.Equals(key, value)
+	}
+	return b
+}
+
+// Build returns the selector, or the first invalid requirement
+func (b *SelectorBuilder) Build() (labels.Selector, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return labels.NewSelector().Add(b.requirements...), nil
+}
+
+// String returns the selector in its string form, for list options
+func (b *SelectorBuilder) String() (string, error) {
+	selector, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	return selector.String(), nil
+}
+
+// PodFieldSelector ANDs the given terms with an optional raw field selector,
+// checking that every field can be selected on for pods
+func PodFieldSelector(raw string, terms map[string]string) (string, error) {
+	selectors := []fields.Selector{}
+
+	if len(raw) > 0 {
+		parsed, err := fields.ParseSelector(raw)
+		if err != nil {
+			return "", err
+		}
+		selectors = append(selectors, parsed)
+	}
+	for key, value := range terms {
+		if len(value) > 0 {
+			selectors = append(selectors, fields.OneTermEqualSelector(key, value))
+		}
+	}
+
+	selector := fields.AndSelectors(selectors...)
+	for _, r := range selector.Requirements() {
+		if !podFieldSelectorKeys[r.Field] {
+			return "", fmt.Errorf("field %s cannot be selected on for pods", r.Field)
+		}
+	}
+
+	if selector.Empty() {
+		return "", nil
+	}
+	return selector.String(), nil
+}
+
+// podFields are the selectable fields of a pod, to match field selectors
+// against pods in the cache
+func podFields(pod *v1.Pod) fields.Set {
+	return fields.Set{
+		"metadata.name":            pod.Name,
+		"metadata.namespace":       pod.Namespace,
+		"spec.nodeName":            pod.Spec.NodeName,
+		"spec.restartPolicy":       string(pod.Spec.RestartPolicy),
+		"spec.schedulerName":       pod.Spec.SchedulerName,
+		"spec.serviceAccountName":  pod.Spec.ServiceAccountName,
+		"status.phase":             string(pod.Status.Phase),
+		"status.podIP":             pod.Status.PodIP,
+		"status.nominatedNodeName": pod.Status.NominatedNodeName,
+	}
+}
@@ -0,0 +1,153 @@
+package k8s
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Container states
+const (
+	ContainerRunning    = "Running"
+	ContainerWaiting    = "Waiting"
+	ContainerTerminated = "Terminated"
+	ContainerUnknown    = "Unknown"
+)
+
+type ContainerSummary struct {
+	Name                    string            `json:"name"`
+	Image                   string            `json:"image"`
+	State                   string            `json:"state"`
+	Reason                  string            `json:"reason,omitempty"`
+	Message                 string            `json:"message,omitempty"`
+	ExitCode                *int32            `json:"exitCode,omitempty"`
+	StartedAt               *metav1.Time      `json:"startedAt,omitempty"`
+	Ready                   bool              `json:"ready"`
+	RestartCount            int32             `json:"restartCount"`
+	LastTerminationReason   string            `json:"lastTerminationReason,omitempty"`
+	LastTerminationExitCode *int32            `json:"lastTerminationExitCode,omitempty"`
+	Requests                map[string]string `json:"requests,omitempty"`
+	Limits                  map[string]string `json:"limits,omitempty"`
+}
+
+type PodConditionSummary struct {
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+func resourceListToMap(resources v1.ResourceList) map[string]string {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		result[string(name)] = quantity.String()
+	}
+	return result
+}
+
+// summarizeContainers combines the spec and the status of the containers.
+// Containers without a status yet (e.g. not scheduled) are reported as Unknown.
+func summarizeContainers(containers []v1.Container, statuses []v1.ContainerStatus) []ContainerSummary {
+	statusByName := make(map[string]v1.ContainerStatus, len(statuses))
+	for _, status := range statuses {
+		statusByName[status.Name] = status
+	}
+
+	result := make([]ContainerSummary, 0, len(containers))
+	for _, container := range containers {
+		summary := ContainerSummary{
+			Name:     container.Name,
+			Image:    container.Image,
+			State:    ContainerUnknown,
+			Requests: resourceListToMap(container.Resources.Requests),
+			Limits:   resourceListToMap(container.Resources.Limits),
+		}
+
+		status, ok := statusByName[container.Name]
+		if !ok {
+			result = append(result, summary)
+			continue
+		}
+
+		summary.Ready = status.Ready
+		summary.RestartCount = status.RestartCount
+
+		state := status.State
+		switch {
+		case state.Running != nil:
+			summary.State = ContainerRunning
+			startedAt := state.Running.StartedAt
+			summary.StartedAt = &startedAt
+		case state.Waiting != nil:
+			summary.State = ContainerWaiting
+			summary.Reason = state.Waiting.Reason
+			summary.Message = state.Waiting.Message
+		case state.Terminated != nil:
+			summary.State = ContainerTerminated
+			summary.Reason = state.Terminated.Reason
+			summary.Message = state.Terminated.Message
+			exitCode := state.Terminated.ExitCode
+			summary.ExitCode = &exitCode
+			startedAt := state.Terminated.StartedAt
+			summary.StartedAt = &startedAt
+		}
+
+		if last := status.LastTerminationState.Terminated; last != nil {
+			summary.LastTerminationReason = last.Reason
+			exitCode := last.ExitCode
+			summary.LastTerminationExitCode = &exitCode
+		}
+
+		result = append(result, summary)
+	}
+
+	return result
+}
+
+func summarizeConditions(conditions []v1.PodCondition) []PodConditionSummary {
+	result := make([]PodConditionSummary, len(conditions))
+	for i, condition := range conditions {
+		result[i] = PodConditionSummary{
+			Type:               string(condition.Type),
+			Status:             string(condition.Status),
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime,
+		}
+	}
+	return result
+}
+
+// podStatusReason explains the state of a pod the way kubectl get pods
+// does: Terminating, the reason of the pod (e.g. Evicted), or the reason
+// a container is waiting or terminated (e.g. CrashLoopBackOff, OOMKilled)
+func podStatusReason(pod *v1.Pod, containers []ContainerSummary, initContainers []ContainerSummary) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	if len(pod.Status.Reason) > 0 {
+		return pod.Status.Reason
+	}
+
+	for _, container := range initContainers {
+		if container.State == ContainerTerminated && container.ExitCode != nil && *container.ExitCode == 0 {
+			continue
+		}
+		if len(container.Reason) > 0 {
+			return "Init:" + container.Reason
+		}
+	}
+
+	for _, container := range containers {
+		if container.State != ContainerRunning && len(container.Reason) > 0 {
+			return container.Reason
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestGetSummaryFromPod(t *testing.T) {
+	created := metav1.NewTime(time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC))
+	started := metav1.NewTime(time.Date(2021, 3, 1, 10, 1, 0, 0, time.UTC))
+	deleted := metav1.NewTime(time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC))
+
+	meta := metav1.ObjectMeta{
+		Name:              "rt-abc-0",
+		Namespace:         "runtimes",
+		UID:               "uid-1",
+		CreationTimestamp: created,
+		Labels: map[string]string{
+			"userRuntimeOwner":           "alice",
+			"app.kubernetes.io/instance": "rt-abc",
+		},
+	}
+	spec := v1.PodSpec{
+		NodeName:   "node-1",
+		Containers: []v1.Container{{Name: "runtime", Image: "mayanr:1"}},
+	}
+	summary := func(s PodSummary) PodSummary {
+		s.Name = "rt-abc-0"
+		s.Namespace = "runtimes"
+		s.Uid = "uid-1"
+		s.CreatedAt = created
+		s.OwnerId = "alice"
+		s.RuntimeId = "abc"
+		s.Node = "node-1"
+		s.Conditions = []PodConditionSummary{}
+		s.InitContainers = []ContainerSummary{}
+		return s
+	}
+
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want PodSummary
+	}{
+		{
+			name: "pending without container statuses",
+			pod: &v1.Pod{
+				ObjectMeta: meta,
+				Spec:       spec,
+				Status:     v1.PodStatus{Phase: v1.PodPending},
+			},
+			want: summary(PodSummary{
+				Status:     "Pending",
+				Containers: []ContainerSummary{{Name: "runtime", Image: "mayanr:1", State: ContainerUnknown}},
+			}),
+		},
+		{
+			name: "pending while pulling the image",
+			pod: &v1.Pod{
+				ObjectMeta: meta,
+				Spec:       spec,
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					ContainerStatuses: []v1.ContainerStatus{{
+						Name:  "runtime",
+						State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+					}},
+				},
+			},
+			want: summary(PodSummary{
+				Status:       "Pending",
+				StatusReason: "ContainerCreating",
+				Containers: []ContainerSummary{{
+					Name:   "runtime",
+					Image:  "mayanr:1",
+					State:  ContainerWaiting,
+					Reason: "ContainerCreating",
+				}},
+			}),
+		},
+		{
+			name: "crashloop",
+			pod: &v1.Pod{
+				ObjectMeta: meta,
+				Spec:       spec,
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{{
+						Name:                 "runtime",
+						RestartCount:         4,
+						State:                v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 1m20s"}},
+						LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+					}},
+				},
+			},
+			want: summary(PodSummary{
+				Status:                "Running",
+				StatusReason:          "CrashLoopBackOff",
+				RestartCount:          4,
+				LastTerminationReason: "Error",
+				Containers: []ContainerSummary{{
+					Name:                    "runtime",
+					Image:                   "mayanr:1",
+					State:                   ContainerWaiting,
+					Reason:                  "CrashLoopBackOff",
+					Message:                 "back-off 1m20s",
+					RestartCount:            4,
+					LastTerminationReason:   "Error",
+					LastTerminationExitCode: int32Ptr(1),
+				}},
+			}),
+		},
+		{
+			name: "OOMKilled",
+			pod: &v1.Pod{
+				ObjectMeta: meta,
+				Spec:       spec,
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{{
+						Name:         "runtime",
+						RestartCount: 1,
+						State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+							Reason:    "OOMKilled",
+							ExitCode:  137,
+							StartedAt: started,
+						}},
+					}},
+				},
+			},
+			want: summary(PodSummary{
+				Status:       "Running",
+				StatusReason: "OOMKilled",
+				RestartCount: 1,
+				Containers: []ContainerSummary{{
+					Name:         "runtime",
+					Image:        "mayanr:1",
+					State:        ContainerTerminated,
+					Reason:       "OOMKilled",
+					ExitCode:     int32Ptr(137),
+					StartedAt:    &started,
+					RestartCount: 1,
+				}},
+			}),
+		},
+		{
+			name: "terminating",
+			pod: func() *v1.Pod {
+				pod := &v1.Pod{
+					ObjectMeta: *meta.DeepCopy(),
+					Spec:       spec,
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						ContainerStatuses: []v1.ContainerStatus{{
+							Name:  "runtime",
+							Ready: true,
+							State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: started}},
+						}},
+						Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+					},
+				}
+				pod.DeletionTimestamp = &deleted
+				return pod
+			}(),
+			want: func() PodSummary {
+				s := summary(PodSummary{
+					Status:       "Running",
+					StatusReason: "Terminating",
+					Terminating:  true,
+					StartTime:    started,
+					Containers: []ContainerSummary{{
+						Name:      "runtime",
+						Image:     "mayanr:1",
+						State:     ContainerRunning,
+						StartedAt: &started,
+						Ready:     true,
+					}},
+				})
+				s.Conditions = []PodConditionSummary{{Type: "Ready", Status: "True"}}
+				return s
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getSummaryFromPod(tt.pod)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getSummaryFromPod() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
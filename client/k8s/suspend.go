@@ -0,0 +1,208 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// suspendedReplicasAnnotation keeps the replica count a workload had
+	// before its runtime was suspended
+	suspendedReplicasAnnotation = "helmapi.mayahq.com/suspended-replicas"
+	// suspendedAtAnnotation is when the runtime was suspended (RFC 3339)
+	suspendedAtAnnotation = "helmapi.mayahq.com/suspended-at"
+)
+
+// SuspendState tells whether a runtime is scaled to zero by SuspendRuntime
+type SuspendState struct {
+	Suspended   bool       `json:"suspended"`
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty"`
+}
+
+// SuspendRuntime scales the Deployments and StatefulSets of a runtime to zero
+// replicas, recording their replica counts in an annotation so that
+// ResumeRuntime can restore them. Workloads that are already suspended are
+// left alone. It does not wait for the pods to go away.
+func SuspendRuntime(ctx context.Context, namespace string, runtimeId string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	workloads, err := runtimeWorkloads(ctx, clientset, namespace, runtimeId)
+	if err != nil {
+		return err
+	}
+
+	if len(workloads) == 0 {
+		return fmt.Errorf("no workloads found for runtime %s", runtimeId)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	for _, w := range workloads {
+		if _, ok := w.annotations[suspendedReplicasAnnotation]; ok {
+			continue
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{
+					suspendedReplicasAnnotation: strconv.Itoa(int(w.replicas)),
+					suspendedAtAnnotation:       now,
+				},
+			},
+			"spec": map[string]interface{}{"replicas": 0},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := w.patch(ctx, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not scale down %s %s: %v", w.kind, w.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ResumeRuntime restores the replica counts recorded by SuspendRuntime.
+// It does not wait for the pods to become ready.
+func ResumeRuntime(ctx context.Context, namespace string, runtimeId string) error {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return err
+	}
+
+	workloads, err := runtimeWorkloads(ctx, clientset, namespace, runtimeId)
+	if err != nil {
+		return err
+	}
+
+	resumed := 0
+	for _, w := range workloads {
+		value, ok := w.annotations[suspendedReplicasAnnotation]
+		if !ok {
+			continue
+		}
+
+		replicas, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on %s %s: %v", suspendedReplicasAnnotation, w.kind, w.name, err)
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					suspendedReplicasAnnotation: nil,
+					suspendedAtAnnotation:       nil,
+				},
+			},
+			"spec": map[string]interface{}{"replicas": replicas},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := w.patch(ctx, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not scale up %s %s: %v", w.kind, w.name, err)
+		}
+		resumed++
+	}
+
+	if resumed == 0 {
+		return fmt.Errorf("runtime %s is not suspended", runtimeId)
+	}
+
+	return nil
+}
+
+// GetSuspendState tells whether any workload of a runtime is suspended,
+// and since when
+func GetSuspendState(ctx context.Context, namespace string, runtimeId string) (SuspendState, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return SuspendState{}, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return SuspendState{}, err
+	}
+
+	workloads, err := runtimeWorkloads(ctx, clientset, namespace, runtimeId)
+	if err != nil {
+		return SuspendState{}, err
+	}
+
+	state := SuspendState{}
+	for _, w := range workloads {
+		if _, ok := w.annotations[suspendedReplicasAnnotation]; !ok {
+			continue
+		}
+		state.Suspended = true
+		if at, err := time.Parse(time.RFC3339, w.annotations[suspendedAtAnnotation]); err == nil {
+			if state.SuspendedAt == nil || at.Before(*state.SuspendedAt) {
+				state.SuspendedAt = &at
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// SuspendedRuntimes returns the IDs of the runtimes in a namespace that have
+// a suspended workload. The workloads of all runtimes are listed at once.
+func SuspendedRuntimes(ctx context.Context, namespace string) (map[string]bool, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	clientset, err := getClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err = namespaceOrDefault(kubeconfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := new(SelectorBuilder).Exists("app.kubernetes.io/instance").String()
+	if err != nil {
+		return nil, err
+	}
+
+	workloads, err := listWorkloads(ctx, clientset, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	suspended := make(map[string]bool)
+	for _, w := range workloads {
+		if _, ok := w.annotations[suspendedReplicasAnnotation]; !ok {
+			continue
+		}
+		if instance := w.labels["app.kubernetes.io/instance"]; strings.HasPrefix(instance, "rt-") {
+			suspended[strings.TrimPrefix(instance, "rt-")] = true
+		}
+	}
+
+	return suspended, nil
+}
@@ -0,0 +1,188 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Types of pod events
+const (
+	PodAdded    = "ADDED"
+	PodModified = "MODIFIED"
+	PodDeleted  = "DELETED"
+)
+
+const (
+	// podEventHistory is the number of recent events kept to resume watches from
+	podEventHistory = 1024
+	// podEventBuffer is how many events a watcher can fall behind before
+	// it is disconnected
+	podEventBuffer = 256
+)
+
+// PodEvent is a change to a runtime pod
+type PodEvent struct {
+	Type            string     `json:"type"`
+	ResourceVersion string     `json:"resourceVersion"`
+	Pod             PodSummary `json:"pod"`
+}
+
+// PodFilter narrows down the pods a watch reports. Empty fields match everything.
+type PodFilter struct {
+	Users     []string
+	Namespace string
+}
+
+func (f *PodFilter) matches(pod PodSummary) bool {
+	if len(f.Namespace) > 0 && pod.Namespace != f.Namespace {
+		return false
+	}
+
+	if len(f.Users) == 0 {
+		return true
+	}
+	for _, user := range f.Users {
+		if pod.OwnerId == user {
+			return true
+		}
+	}
+	return false
+}
+
+type podWatcher struct {
+	filter PodFilter
+	events chan PodEvent
+}
+
+// podEventHub fans the events of the pod informer out to the watchers
+type podEventHub struct {
+	mu       sync.Mutex
+	watchers map[*podWatcher]struct{}
+	history  []PodEvent
+}
+
+var podEvents = &podEventHub{watchers: make(map[*podWatcher]struct{})}
+
+func (h *podEventHub) publish(eventType string, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+
+	recordPodEvent()
+
+	event := PodEvent{
+		Type:            eventType,
+		ResourceVersion: pod.ResourceVersion,
+		Pod:             getSummaryFromPod(pod),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.history = append(h.history, event)
+	if len(h.history) > podEventHistory {
+		h.history = h.history[len(h.history)-podEventHistory:]
+	}
+
+	for w := range h.watchers {
+		if !w.filter.matches(event.Pod) {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			// The watcher cannot keep up; it can resume from the
+			// last resourceVersion it has seen
+			delete(h.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// WatchRuntimePods streams changes to runtime pods until ctx is done. If
+// resourceVersion is the version of a recent event, the events after it are
+// replayed first; otherwise the watch starts with an ADDED event for every
+// current pod. The channel is closed when ctx is done or when the reader
+// falls too far behind.
+func WatchRuntimePods(ctx context.Context, filter PodFilter, resourceVersion string) (<-chan PodEvent, error) {
+	informer, err := runtimePodInformer()
+	if err != nil {
+		return nil, err
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, ctx.Err()
+	}
+
+	podEvents.mu.Lock()
+	replay := podEvents.replay(resourceVersion)
+	if replay == nil {
+		replay = currentPodEvents(informer.GetStore())
+	}
+
+	w := &podWatcher{
+		filter: filter,
+		events: make(chan PodEvent, len(replay)+podEventBuffer),
+	}
+	for _, event := range replay {
+		if filter.matches(event.Pod) {
+			w.events <- event
+		}
+	}
+	podEvents.watchers[w] = struct{}{}
+	podEvents.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		podEvents.mu.Lock()
+		defer podEvents.mu.Unlock()
+		if _, ok := podEvents.watchers[w]; ok {
+			delete(podEvents.watchers, w)
+			close(w.events)
+		}
+	}()
+
+	return w.events, nil
+}
+
+// replay returns the events after the one with the given resourceVersion,
+// or nil if that event is not in the history. Must be called with h.mu held.
+func (h *podEventHub) replay(resourceVersion string) []PodEvent {
+	if len(resourceVersion) == 0 {
+		return nil
+	}
+
+	for i := len(h.history) - 1; i >= 0; i-- {
+		if h.history[i].ResourceVersion == resourceVersion {
+			return append([]PodEvent{}, h.history[i+1:]...)
+		}
+	}
+
+	return nil
+}
+
+func currentPodEvents(store cache.Store) []PodEvent {
+	objs := store.List()
+	events := make([]PodEvent, 0, len(objs))
+
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		events = append(events, PodEvent{
+			Type:            PodAdded,
+			ResourceVersion: pod.ResourceVersion,
+			Pod:             getSummaryFromPod(pod),
+		})
+	}
+
+	return events
+}
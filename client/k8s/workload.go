@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workload is a Deployment or StatefulSet of a runtime release
+type workload struct {
+	kind        string
+	name        string
+	replicas    int32
+	labels      map[string]string
+	annotations map[string]string
+	patch       func(ctx context.Context, pt types.PatchType, data []byte) error
+}
+
+// runtimeWorkloads lists the Deployments and StatefulSets of the
+// rt-<runtimeId> release
+func runtimeWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string, runtimeId string) ([]workload, error) {
+	selector, err := new(SelectorBuilder).Runtime(runtimeId).String()
+	if err != nil {
+		return nil, err
+	}
+	return listWorkloads(ctx, clientset, namespace, selector)
+}
+
+// listWorkloads lists the Deployments and StatefulSets matching a label
+// selector
+func listWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string, selector string) ([]workload, error) {
+	listOptions := metav1.ListOptions{
+		LabelSelector: selector,
+	}
+	workloads := []workload{}
+
+	deployments := clientset.AppsV1().Deployments(namespace)
+	deploymentList, err := deployments.List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deploymentList.Items {
+		name := deployment.Name
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		workloads = append(workloads, workload{
+			kind:        "Deployment",
+			name:        name,
+			replicas:    replicas,
+			labels:      deployment.Labels,
+			annotations: deployment.Annotations,
+			patch: func(ctx context.Context, pt types.PatchType, data []byte) error {
+				_, err := deployments.Patch(ctx, name, pt, data, metav1.PatchOptions{})
+				return err
+			},
+		})
+	}
+
+	statefulSets := clientset.AppsV1().StatefulSets(namespace)
+	statefulSetList, err := statefulSets.List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSetList.Items {
+		name := statefulSet.Name
+		replicas := int32(1)
+		if statefulSet.Spec.Replicas != nil {
+			replicas = *statefulSet.Spec.Replicas
+		}
+		workloads = append(workloads, workload{
+			kind:        "StatefulSet",
+			name:        name,
+			replicas:    replicas,
+			labels:      statefulSet.Labels,
+			annotations: statefulSet.Annotations,
+			patch: func(ctx context.Context, pt types.PatchType, data []byte) error {
+				_, err := statefulSets.Patch(ctx, name, pt, data, metav1.PatchOptions{})
+				return err
+			},
+		})
+	}
+
+	return workloads, nil
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+// LockLabel is set on every lease helmapi creates, with the kind of lock as value
+const LockLabel = "helmapi.mayahq.com/lock"
+
+// lockWait is how long to wait for a lock someone else holds before giving up
+const lockWait = 2 * time.Minute
+
+// ownerLockWait is lockWait for owner locks. Those are held for a whole
+// install, so a batch of creates for one owner queues up for longer.
+const ownerLockWait = 10 * time.Minute
+
+// LockBusyError is returned when the lock of a release or owner is still
+// held by someone else after waiting for it
+type LockBusyError struct {
+	Kind string
+	Name string
+}
+
+func (e *LockBusyError) Error() string {
+	return fmt.Sprintf("%s %s is busy, try again later", e.Kind, e.Name)
+}
+
+// acquireLock takes the lease of a lock, waiting for at most wait while
+// someone else holds it. kind and name tell what the lock is for.
+func acquireLock(lm *k8s.LeaseManager, leaseName string, kind string, name string, wait time.Duration) (*k8s.Lock, error) {
+	lock, err := lm.AcquireWait(context.Background(), leaseName, map[string]string{LockLabel: kind}, wait)
+	if _, held := err.(*k8s.ErrLeaseHeld); held {
+		return nil, &LockBusyError{Kind: kind, Name: name}
+	}
+	return lock, err
+}
+
+// lockRelease takes the cluster wide lock of a helm release, so that only one
+// replica runs helm against it at a time. If the release is busy it waits up
+// to lockWait for it. The returned function releases it.
+func lockRelease(releaseName string) (func(), error) {
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireLock(lm, "helmapi-release-"+releaseName, "release", releaseName, lockWait)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := func() {
+		if err := lock.Delete(context.Background()); err != nil {
+			log.Println("Could not release lock of", releaseName, err)
+		}
+	}
+	return unlock, nil
+}
+
+// lockOwner takes the cluster wide lock of a runtime owner, so that quota
+// checks and installs for one owner do not race. It must be taken before
+// the lock of any release. Concurrent creates for one owner queue up on it
+// for at most ownerLockWait.
+func lockOwner(owner string) (func(), error) {
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		return nil, err
+	}
+
+	// Owners are label values, which may not be valid object names
+	sum := sha256.Sum256([]byte(owner))
+	name := "helmapi-owner-" + hex.EncodeToString(sum[:8])
+
+	lock, err := acquireLock(lm, name, "owner", owner, ownerLockWait)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := func() {
+		if err := lock.Delete(context.Background()); err != nil {
+			log.Println("Could not release lock of owner", owner, err)
+		}
+	}
+	return unlock, nil
+}
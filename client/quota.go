@@ -0,0 +1,388 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quotaConfigEnv names the environment variable holding the path of a JSON
+// file with the QuotaConfig. Without it there are no quotas.
+const quotaConfigEnv = "QUOTA_CONFIG"
+
+// QuotaLimits bounds what the runtimes of one owner may use. Zero or empty
+// fields mean no limit.
+type QuotaLimits struct {
+	MaxRuntimes int    `json:"maxRuntimes,omitempty"`
+	CPU         string `json:"cpu,omitempty"`
+	Memory      string `json:"memory,omitempty"`
+}
+
+// UserQuota puts a user in a tier. Limits set here take precedence over
+// those of the tier.
+type UserQuota struct {
+	Tier string `json:"tier,omitempty"`
+	QuotaLimits
+}
+
+// QuotaConfig holds the limits of every user. Users that are not listed,
+// or have no tier, get the default limits.
+type QuotaConfig struct {
+	Default QuotaLimits            `json:"default"`
+	Tiers   map[string]QuotaLimits `json:"tiers"`
+	Users   map[string]UserQuota   `json:"users"`
+}
+
+// QuotaUsage is what the runtimes of an owner use. CPU and memory are the
+// sums of the requests of their containers, or of the values of runtimes
+// whose pods do not exist yet.
+type QuotaUsage struct {
+	Runtimes   int      `json:"runtimes"`
+	RuntimeIds []string `json:"runtimeIds"`
+	CPU        string   `json:"cpu"`
+	Memory     string   `json:"memory"`
+}
+
+// Quota is the limits and usage of a user
+type Quota struct {
+	User   string      `json:"user"`
+	Tier   string      `json:"tier,omitempty"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+}
+
+// QuotaExceededError is returned when creating a runtime would take its owner
+// over one of their limits
+type QuotaExceededError struct {
+	User      string
+	Resource  string
+	Limit     string
+	Used      string
+	Requested string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %s limit is %s, %s in use, %s requested",
+		e.User, e.Resource, e.Limit, e.Used, e.Requested)
+}
+
+// loadQuotaConfig reads the quota config. It is read on every call so that
+// changes to a mounted ConfigMap are picked up without a restart.
+func loadQuotaConfig() (*QuotaConfig, error) {
+	path := os.Getenv(quotaConfigEnv)
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config QuotaConfig
+	err = json.NewDecoder(f).Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// limitsFor returns the tier and limits of a user
+func (c *QuotaConfig) limitsFor(user string) (string, QuotaLimits) {
+	limits := c.Default
+	uq, ok := c.Users[user]
+	if !ok {
+		return "", limits
+	}
+
+	if tier, ok := c.Tiers[uq.Tier]; ok {
+		limits = tier
+	}
+	if uq.MaxRuntimes > 0 {
+		limits.MaxRuntimes = uq.MaxRuntimes
+	}
+	if len(uq.CPU) > 0 {
+		limits.CPU = uq.CPU
+	}
+	if len(uq.Memory) > 0 {
+		limits.Memory = uq.Memory
+	}
+	return uq.Tier, limits
+}
+
+// releaseQuotaInfo is what the quota needs from the values of a release
+type releaseQuotaInfo struct {
+	revision string
+	updated  string
+	owner    string
+	cpu      resource.Quantity
+	memory   resource.Quantity
+}
+
+var (
+	releaseQuotaInfosMu sync.Mutex
+	// releaseQuotaInfos caches releaseQuotaInfo by release name. The values
+	// of a release only change with a new revision, so an entry is good
+	// for as long as the revision it was read at is the current one. The
+	// update time tells a release installed again under the same name
+	// apart.
+	releaseQuotaInfos = make(map[string]releaseQuotaInfo)
+)
+
+// releaseQuotaInfoOf returns the owner and requests of a release, reading
+// its values only if they are not cached for its current revision
+func releaseQuotaInfoOf(release ReleaseInfo) (releaseQuotaInfo, error) {
+	releaseQuotaInfosMu.Lock()
+	info, ok := releaseQuotaInfos[release.Name]
+	releaseQuotaInfosMu.Unlock()
+	if ok && info.revision == release.Revision && info.updated == release.Updated {
+		return info, nil
+	}
+
+	values, err := getChartInfoFromRuntimeId(strings.TrimPrefix(release.Name, "rt-"))
+	if err != nil {
+		return releaseQuotaInfo{}, err
+	}
+	info = releaseQuotaInfo{
+		revision: release.Revision,
+		updated:  release.Updated,
+		owner:    ownerOfValues(values),
+	}
+	info.cpu, info.memory = requestedResources(values)
+
+	releaseQuotaInfosMu.Lock()
+	releaseQuotaInfos[release.Name] = info
+	releaseQuotaInfosMu.Unlock()
+	return info, nil
+}
+
+// forgetReleaseQuotaInfo drops the cached entries of the releases that are
+// not in listed
+func forgetReleaseQuotaInfo(listed map[string]bool) {
+	releaseQuotaInfosMu.Lock()
+	defer releaseQuotaInfosMu.Unlock()
+	for name := range releaseQuotaInfos {
+		if !listed[name] {
+			delete(releaseQuotaInfos, name)
+		}
+	}
+}
+
+// ownerUsage sums up the runtimes of an owner: those with pods, and the rt-*
+// releases of the owner that have none yet, so that runtimes installed a
+// moment ago count before their pods show up. Suspended runtimes have no
+// pods on purpose, so they do not count. It runs under the owner lock, so
+// the values of releases are cached and suspended runtimes are listed
+// once rather than looked up release by release.
+func ownerUsage(ctx context.Context, owner string) (QuotaUsage, resource.Quantity, resource.Quantity, error) {
+	var cpu, memory resource.Quantity
+
+	selector, err := k8s.NewRuntimeSelector().String()
+	if err != nil {
+		return QuotaUsage{}, cpu, memory, err
+	}
+
+	// The pods of every owner, to tell which releases have pods at all
+	pods, err := k8s.ListRuntimePods(ctx, k8s.PodQuery{Selector: selector})
+	if err != nil {
+		return QuotaUsage{}, cpu, memory, err
+	}
+
+	runtimes := make(map[string]bool)
+	withPods := make(map[string]bool)
+	for _, pod := range pods.Pods {
+		if len(pod.RuntimeId) > 0 {
+			withPods[pod.RuntimeId] = true
+		}
+		if pod.OwnerId != owner || pod.Status == "Succeeded" || pod.Status == "Failed" {
+			continue
+		}
+		if len(pod.RuntimeId) > 0 {
+			runtimes[pod.RuntimeId] = true
+		}
+		for _, container := range pod.Containers {
+			if q, err := resource.ParseQuantity(container.Requests["cpu"]); err == nil {
+				cpu.Add(q)
+			}
+			if q, err := resource.ParseQuantity(container.Requests["memory"]); err == nil {
+				memory.Add(q)
+			}
+		}
+	}
+
+	releases, err := listReleases("^rt-")
+	if err != nil {
+		return QuotaUsage{}, cpu, memory, err
+	}
+	listed := make(map[string]bool, len(releases))
+	suspended := make(map[string]map[string]bool)
+	for _, release := range releases {
+		listed[release.Name] = true
+		runtimeId := strings.TrimPrefix(release.Name, "rt-")
+		if withPods[runtimeId] || release.Status == "uninstalling" || release.Status == "uninstalled" {
+			continue
+		}
+
+		info, err := releaseQuotaInfoOf(release)
+		if err != nil {
+			return QuotaUsage{}, cpu, memory, err
+		}
+		if info.owner != owner {
+			continue
+		}
+
+		// Suspended runtimes are looked up once per namespace
+		if _, ok := suspended[release.Namespace]; !ok {
+			suspended[release.Namespace], err = k8s.SuspendedRuntimes(ctx, release.Namespace)
+			if err != nil {
+				return QuotaUsage{}, cpu, memory, err
+			}
+		}
+		if suspended[release.Namespace][runtimeId] {
+			continue
+		}
+
+		runtimes[runtimeId] = true
+		cpu.Add(info.cpu)
+		memory.Add(info.memory)
+	}
+	forgetReleaseQuotaInfo(listed)
+
+	usage := QuotaUsage{
+		Runtimes:   len(runtimes),
+		RuntimeIds: make([]string, 0, len(runtimes)),
+		CPU:        cpu.String(),
+		Memory:     memory.String(),
+	}
+	for runtimeId := range runtimes {
+		usage.RuntimeIds = append(usage.RuntimeIds, runtimeId)
+	}
+	sort.Strings(usage.RuntimeIds)
+
+	return usage, cpu, memory, nil
+}
+
+// GetQuota returns the limits of a user and what their runtimes use
+func GetQuota(ctx context.Context, user string) (Quota, error) {
+	config, err := loadQuotaConfig()
+	if err != nil {
+		return Quota{}, err
+	}
+
+	quota := Quota{User: user}
+	if config != nil {
+		quota.Tier, quota.Limits = config.limitsFor(user)
+	}
+
+	quota.Usage, _, _, err = ownerUsage(ctx, user)
+	if err != nil {
+		return Quota{}, err
+	}
+	return quota, nil
+}
+
+// requestedResources reads the requests of a new runtime from the
+// resources.requests values of the chart, if they are set
+func requestedResources(values map[string]interface{}) (resource.Quantity, resource.Quantity) {
+	var cpu, memory resource.Quantity
+
+	resources, _ := values["resources"].(map[string]interface{})
+	requests, _ := resources["requests"].(map[string]interface{})
+	parse := func(v interface{}) resource.Quantity {
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		q, err := resource.ParseQuantity(s)
+		if err != nil {
+			return resource.Quantity{}
+		}
+		return q
+	}
+
+	if v, ok := requests["cpu"]; ok {
+		cpu = parse(v)
+	}
+	if v, ok := requests["memory"]; ok {
+		memory = parse(v)
+	}
+	return cpu, memory
+}
+
+// checkQuota fails with a *QuotaExceededError if one more runtime with the
+// given values would take owner over their limits. The caller should hold
+// the lock of the owner.
+func checkQuota(ctx context.Context, owner string, values map[string]interface{}) error {
+	config, err := loadQuotaConfig()
+	if err != nil || config == nil {
+		return err
+	}
+
+	_, limits := config.limitsFor(owner)
+	if limits.MaxRuntimes == 0 && len(limits.CPU) == 0 && len(limits.Memory) == 0 {
+		return nil
+	}
+
+	usage, cpu, memory, err := ownerUsage(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxRuntimes > 0 && usage.Runtimes+1 > limits.MaxRuntimes {
+		return &QuotaExceededError{
+			User:      owner,
+			Resource:  "runtimes",
+			Limit:     strconv.Itoa(limits.MaxRuntimes),
+			Used:      strconv.Itoa(usage.Runtimes),
+			Requested: "1",
+		}
+	}
+
+	requestedCPU, requestedMemory := requestedResources(values)
+	check := func(name string, limit string, used resource.Quantity, requested resource.Quantity) error {
+		if len(limit) == 0 {
+			return nil
+		}
+		max, err := resource.ParseQuantity(limit)
+		if err != nil {
+			return fmt.Errorf("invalid %s quota %s: %v", name, limit, err)
+		}
+		total := used.DeepCopy()
+		total.Add(requested)
+		if total.Cmp(max) > 0 {
+			return &QuotaExceededError{
+				User:      owner,
+				Resource:  name,
+				Limit:     max.String(),
+				Used:      used.String(),
+				Requested: requested.String(),
+			}
+		}
+		return nil
+	}
+
+	if err := check("cpu", limits.CPU, cpu, requestedCPU); err != nil {
+		return err
+	}
+	return check("memory", limits.Memory, memory, requestedMemory)
+}
+
+// ownerOfValues returns the userRuntimeOwner pod label set in the values
+// of a release, if any
+func ownerOfValues(values map[string]interface{}) string {
+	podLabels, _ := values["podLabels"].(map[string]interface{})
+	owner, _ := podLabels["userRuntimeOwner"].(string)
+	return owner
+}
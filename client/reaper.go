@@ -0,0 +1,503 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	coordv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// reaperPolicyEnv names the environment variable holding the path of a JSON
+// file with the ReaperPolicy. The reaper does not run if it is not set.
+const reaperPolicyEnv = "REAPER_POLICY"
+
+// reaperOverridesConfigMap keeps the overrides of the reaper, one key per
+// runtime, so that every replica sees them
+const reaperOverridesConfigMap = "helmapi-reaper-overrides"
+
+// reaperLeaseName is the lease held by the replica running the reaper
+const reaperLeaseName = "helmapi-reaper"
+
+// reaperReportAnnotation is the annotation of the reaper lease that holds
+// the report of the last run, whichever replica made it
+const reaperReportAnnotation = "helmapi.mayahq.com/reaper-report"
+
+// Actions of the reaper
+const (
+	ReaperSuspend = "suspend"
+	ReaperDelete  = "delete"
+	ReaperSkip    = "skip"
+)
+
+// ReaperPolicy decides which runtimes the reaper acts on. Durations are
+// strings like "72h", empty ones disable their rule.
+type ReaperPolicy struct {
+	// Action is what is done to the runtimes picked, suspend (the
+	// default) or delete
+	Action string `json:"action"`
+	// MaxAge is how long the pods of a runtime may live. A restart
+	// starts the count again.
+	MaxAge string `json:"maxAge"`
+	// IdleTTL is how long a runtime may go without activity, as told by
+	// the helmapi.mayahq.com/last-activity annotation of its pods. Pods
+	// without the annotation count as active when they were created.
+	IdleTTL string `json:"idleTtl"`
+	// MaxRuntimesPerOwner picks the least recently active runtimes of an
+	// owner above this many running ones. Zero means no limit.
+	MaxRuntimesPerOwner int `json:"maxRuntimesPerOwner"`
+	// ExcludeLabels are pod labels that keep a runtime from being reaped
+	ExcludeLabels []string `json:"excludeLabels"`
+	// Namespace limits the reaper to one namespace. Empty means all.
+	Namespace string `json:"namespace"`
+	// Interval is the time between two runs, 5m by default
+	Interval string `json:"interval"`
+	// Timeout is passed to helm when deleting
+	Timeout string `json:"timeout"`
+	// DryRun only reports what would be done
+	DryRun bool `json:"dryRun"`
+}
+
+// ReaperOverride changes what the reaper does to one runtime, until a
+// point in time if Until is set
+type ReaperOverride struct {
+	// Action is skip, to leave the runtime alone, or suspend or delete to
+	// act on it at the next run
+	Action string     `json:"action"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// ReaperAction is an action the reaper has planned or taken
+type ReaperAction struct {
+	RuntimeId string          `json:"runtimeId"`
+	OwnerId   string          `json:"ownerId"`
+	Namespace string          `json:"namespace"`
+	Action    string          `json:"action"`
+	Reason    string          `json:"reason"`
+	DueAt     time.Time       `json:"dueAt"`
+	Due       bool            `json:"due"`
+	Override  *ReaperOverride `json:"override,omitempty"`
+	Done      bool            `json:"done,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// ReaperReport is the outcome of a run of the reaper
+type ReaperReport struct {
+	StartedAt time.Time      `json:"startedAt"`
+	DryRun    bool           `json:"dryRun"`
+	Actions   []ReaperAction `json:"actions"`
+}
+
+// LoadReaperPolicy reads the policy of the reaper. It returns nil if
+// REAPER_POLICY is not set.
+func LoadReaperPolicy() (*ReaperPolicy, error) {
+	path := os.Getenv(reaperPolicyEnv)
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var policy ReaperPolicy
+	err = json.NewDecoder(f).Decode(&policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policy.Action) == 0 {
+		policy.Action = ReaperSuspend
+	}
+	if policy.Action != ReaperSuspend && policy.Action != ReaperDelete {
+		return nil, fmt.Errorf("invalid reaper action %s", policy.Action)
+	}
+
+	return &policy, nil
+}
+
+func parseOptionalDuration(name string, value string) (time.Duration, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return d, nil
+}
+
+// reaperRuntime is what the reaper knows about a running runtime
+type reaperRuntime struct {
+	id           string
+	owner        string
+	namespace    string
+	startedAt    time.Time
+	lastActivity time.Time
+}
+
+// groupRuntimes gathers the pods of every runtime. A runtime started when
+// its oldest pod was created, and was last active at the latest activity
+// of its pods.
+func groupRuntimes(pods []k8s.PodSummary) []*reaperRuntime {
+	byId := make(map[string]*reaperRuntime)
+	runtimes := []*reaperRuntime{}
+
+	for _, pod := range pods {
+		if len(pod.RuntimeId) == 0 {
+			continue
+		}
+
+		activity := pod.CreatedAt.Time
+		if pod.LastActivity != nil {
+			activity = *pod.LastActivity
+		}
+
+		rt, ok := byId[pod.RuntimeId]
+		if !ok {
+			rt = &reaperRuntime{
+				id:           pod.RuntimeId,
+				owner:        pod.OwnerId,
+				namespace:    pod.Namespace,
+				startedAt:    pod.CreatedAt.Time,
+				lastActivity: activity,
+			}
+			byId[pod.RuntimeId] = rt
+			runtimes = append(runtimes, rt)
+			continue
+		}
+
+		if pod.CreatedAt.Time.Before(rt.startedAt) {
+			rt.startedAt = pod.CreatedAt.Time
+		}
+		if activity.After(rt.lastActivity) {
+			rt.lastActivity = activity
+		}
+	}
+
+	return runtimes
+}
+
+// planReaper works out what the policy asks for each runtime, taking the
+// overrides into account, ordered by when it is due
+func planReaper(policy ReaperPolicy, runtimes []*reaperRuntime, overrides map[string]ReaperOverride, now time.Time) ([]ReaperAction, error) {
+	maxAge, err := parseOptionalDuration("max age", policy.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	idleTTL, err := parseOptionalDuration("idle TTL", policy.IdleTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make(map[string]*ReaperAction)
+	plan := func(rt *reaperRuntime, dueAt time.Time, reason string) {
+		if a, ok := planned[rt.id]; ok && !dueAt.Before(a.DueAt) {
+			return
+		}
+		planned[rt.id] = &ReaperAction{
+			RuntimeId: rt.id,
+			OwnerId:   rt.owner,
+			Namespace: rt.namespace,
+			Action:    policy.Action,
+			Reason:    reason,
+			DueAt:     dueAt,
+		}
+	}
+
+	byOwner := make(map[string][]*reaperRuntime)
+	for _, rt := range runtimes {
+		if maxAge > 0 {
+			plan(rt, rt.startedAt.Add(maxAge), "running for more than "+policy.MaxAge)
+		}
+		if idleTTL > 0 {
+			plan(rt, rt.lastActivity.Add(idleTTL), "idle for more than "+policy.IdleTTL)
+		}
+		byOwner[rt.owner] = append(byOwner[rt.owner], rt)
+	}
+
+	if policy.MaxRuntimesPerOwner > 0 {
+		for owner, owned := range byOwner {
+			extra := len(owned) - policy.MaxRuntimesPerOwner
+			if extra <= 0 {
+				continue
+			}
+			sort.Slice(owned, func(i, j int) bool {
+				return owned[i].lastActivity.Before(owned[j].lastActivity)
+			})
+			reason := fmt.Sprintf("%s has %d runtimes, the limit is %d", owner, len(owned), policy.MaxRuntimesPerOwner)
+			for _, rt := range owned[:extra] {
+				plan(rt, now, reason)
+			}
+		}
+	}
+
+	byId := make(map[string]*reaperRuntime, len(runtimes))
+	for _, rt := range runtimes {
+		byId[rt.id] = rt
+	}
+	for runtimeId, o := range overrides {
+		override := o
+		if override.Until != nil && override.Until.Before(now) {
+			continue
+		}
+
+		rt, ok := byId[runtimeId]
+		if !ok {
+			continue
+		}
+		if override.Action == ReaperSkip {
+			if a, ok := planned[runtimeId]; ok {
+				a.Override = &override
+			}
+			continue
+		}
+
+		planned[runtimeId] = &ReaperAction{
+			RuntimeId: rt.id,
+			OwnerId:   rt.owner,
+			Namespace: rt.namespace,
+			Action:    override.Action,
+			Reason:    "requested through an override",
+			DueAt:     now,
+			Override:  &override,
+		}
+	}
+
+	actions := make([]ReaperAction, 0, len(planned))
+	for _, a := range planned {
+		a.Due = !a.DueAt.After(now) && (a.Override == nil || a.Override.Action != ReaperSkip)
+		actions = append(actions, *a)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if !actions[i].DueAt.Equal(actions[j].DueAt) {
+			return actions[i].DueAt.Before(actions[j].DueAt)
+		}
+		return actions[i].RuntimeId < actions[j].RuntimeId
+	})
+
+	return actions, nil
+}
+
+func getReaperOverrides(ctx context.Context) (map[string]ReaperOverride, error) {
+	data, err := k8s.GetConfigMapData(ctx, "", reaperOverridesConfigMap)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]ReaperOverride, len(data))
+	for runtimeId, value := range data {
+		var override ReaperOverride
+		if err := json.Unmarshal([]byte(value), &override); err != nil {
+			log.Println("Ignoring invalid reaper override for", runtimeId, err)
+			continue
+		}
+		overrides[runtimeId] = override
+	}
+	return overrides, nil
+}
+
+// SetReaperOverride records an override for a runtime. A nil override
+// removes the current one.
+func SetReaperOverride(ctx context.Context, runtimeId string, override *ReaperOverride) error {
+	if override == nil {
+		return k8s.SetConfigMapKey(ctx, "", reaperOverridesConfigMap, runtimeId, "")
+	}
+
+	switch override.Action {
+	case ReaperSkip, ReaperSuspend, ReaperDelete:
+	default:
+		return fmt.Errorf("invalid reaper action %s", override.Action)
+	}
+
+	value, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	return k8s.SetConfigMapKey(ctx, "", reaperOverridesConfigMap, runtimeId, string(value))
+}
+
+// PlanReaper returns what the reaper would do to the running runtimes now
+// and later, following policy and the overrides
+func PlanReaper(ctx context.Context, policy ReaperPolicy) ([]ReaperAction, error) {
+	builder := k8s.NewRuntimeSelector()
+	for _, label := range policy.ExcludeLabels {
+		builder.Without(label)
+	}
+	selector, err := builder.String()
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude label: %v", err)
+	}
+
+	pods, err := k8s.ListRuntimePods(ctx, k8s.PodQuery{
+		Namespace: policy.Namespace,
+		Selector:  selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := getReaperOverrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return planReaper(policy, groupRuntimes(pods.Pods), overrides, time.Now())
+}
+
+// runReaper carries out the actions that are due, unless the policy is a
+// dry run
+func runReaper(ctx context.Context, policy ReaperPolicy) (*ReaperReport, error) {
+	report := &ReaperReport{StartedAt: time.Now(), DryRun: policy.DryRun, Actions: []ReaperAction{}}
+
+	actions, err := PlanReaper(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, action := range actions {
+		if !action.Due {
+			continue
+		}
+
+		if policy.DryRun {
+			log.Println("Reaper would", action.Action, "runtime", action.RuntimeId+":", action.Reason)
+			report.Actions = append(report.Actions, action)
+			continue
+		}
+
+		log.Println("Reaper will", action.Action, "runtime", action.RuntimeId+":", action.Reason)
+		var err error
+		if action.Action == ReaperDelete {
+			var dr DeleteRequest
+			dr, err = GetDeleteRequestFromRuntimeId(action.RuntimeId)
+			if err == nil {
+				err = dr.Execute(policy.Timeout)
+			}
+		} else {
+			err = SuspendRuntime(action.RuntimeId)
+		}
+
+		if err != nil {
+			action.Error = err.Error()
+		} else {
+			action.Done = true
+			// An override asking for an action is used up once it is done
+			if action.Override != nil {
+				if err := SetReaperOverride(ctx, action.RuntimeId, nil); err != nil {
+					log.Println("Could not clear reaper override for", action.RuntimeId, err)
+				}
+			}
+		}
+		report.Actions = append(report.Actions, action)
+	}
+
+	return report, nil
+}
+
+// reaperReportFromLease reads the report of the last run from the reaper
+// lease. It returns nil if there is none.
+func reaperReportFromLease(lease *coordv1.Lease) *ReaperReport {
+	value, ok := lease.Annotations[reaperReportAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var report ReaperReport
+	if err := json.Unmarshal([]byte(value), &report); err != nil {
+		log.Println("Ignoring invalid reaper report", err)
+		return nil
+	}
+	return &report
+}
+
+// LastReaperReport returns the outcome of the last run of the reaper on any
+// replica, or nil if it has not run yet
+func LastReaperReport(ctx context.Context) (*ReaperReport, error) {
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := lm.Get(ctx, reaperLeaseName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reaperReportFromLease(lease), nil
+}
+
+// RunReaper suspends or deletes runtimes as told by the policy in
+// REAPER_POLICY, forever. The policy is read again on every run. Every
+// replica runs this loop, but only the one holding the reaper lease acts,
+// and only if no replica has run the reaper within the interval.
+func RunReaper() {
+	for {
+		interval := 5 * time.Minute
+
+		policy, err := LoadReaperPolicy()
+		if err != nil {
+			log.Println("Could not load reaper policy", err)
+		}
+		if policy != nil {
+			if d, err := time.ParseDuration(policy.Interval); err == nil && d > 0 {
+				interval = d
+			}
+		}
+
+		if err == nil && policy != nil {
+			reapOnce(*policy, interval)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// reapOnce runs the reaper under its lease, unless the report on the lease
+// shows another run less than interval ago. The report of the run is kept
+// on the lease.
+func reapOnce(policy ReaperPolicy, interval time.Duration) {
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	ctx := context.Background()
+	lock, err := lm.Acquire(ctx, reaperLeaseName, map[string]string{LockLabel: "reaper"})
+	if err != nil {
+		if _, held := err.(*k8s.ErrLeaseHeld); !held {
+			log.Println("Could not acquire reaper lease", err)
+		}
+		return
+	}
+	defer lock.Release(ctx)
+
+	if last := reaperReportFromLease(lock.Lease()); last != nil && time.Since(last.StartedAt) < interval {
+		return
+	}
+
+	report, err := runReaper(ctx, policy)
+	if err != nil {
+		log.Println("Reaper run failed", err)
+		return
+	}
+
+	value, err := json.Marshal(report)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// Written when the lease is released
+	lock.SetAnnotation(reaperReportAnnotation, string(value))
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ReleaseNameMaxLength is the longest release name Helm accepts
+const ReleaseNameMaxLength = 53
+
+// ErrReleaseNotFound is returned when there is no such release
+var ErrReleaseNotFound = errors.New("release not found")
+
+// ReleaseInfo is a helm release as reported by helm list
+type ReleaseInfo struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Revision   string `json:"revision"`
+	Updated    string `json:"updated"`
+	Status     string `json:"status"`
+	Chart      string `json:"chart"`
+	AppVersion string `json:"app_version"`
+}
+
+// ChartVersion returns the version part of the chart the release was
+// installed from (helm reports it as <chart name>-<version>)
+func (ri *ReleaseInfo) ChartVersion(chartName string) string {
+	return strings.TrimPrefix(ri.Chart, chartName+"-")
+}
+
+// listReleases returns the releases of every state whose name matches the
+// regular expression filter
+func listReleases(filter string) ([]ReleaseInfo, error) {
+	app := "helm"
+	args := []string{"list", "--all", "--filter", filter, "-o", "json"}
+
+	cmd := exec.Command(app, args...)
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, errb.String())
+	}
+
+	var releases []ReleaseInfo
+	err = json.NewDecoder(&outb).Decode(&releases)
+	if err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// getRelease looks up a single release by name
+func getRelease(releaseName string) (ReleaseInfo, error) {
+	if len(releaseName) == 0 {
+		return ReleaseInfo{}, fmt.Errorf("you cannot provide an empty release name")
+	}
+
+	releases, err := listReleases("^" + releaseName + "$")
+	if err != nil {
+		return ReleaseInfo{}, err
+	}
+
+	if len(releases) == 0 {
+		return ReleaseInfo{}, ErrReleaseNotFound
+	}
+
+	return releases[0], nil
+}
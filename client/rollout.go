@@ -0,0 +1,615 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	coordv1 "k8s.io/api/coordination/v1"
+)
+
+// Rollout states
+const (
+	RolloutRunning    = "Running"
+	RolloutSucceeded  = "Succeeded"
+	RolloutHalted     = "Halted"
+	RolloutRolledBack = "RolledBack"
+)
+
+// States of a single runtime within a rollout
+const (
+	RuntimePending    = "Pending"
+	RuntimeSucceeded  = "Succeeded"
+	RuntimeFailed     = "Failed"
+	RuntimeSkipped    = "Skipped"
+	RuntimeRolledBack = "RolledBack"
+)
+
+// finishedRolloutTTL is how long a finished rollout stays queryable
+const finishedRolloutTTL = 24 * time.Hour
+
+// rolloutAnnotation is the annotation of the rollout lease that holds
+// the state of the rollout
+const rolloutAnnotation = "helmapi.mayahq.com/rollout"
+
+// rolloutAction is what a rollout does to each runtime
+type rolloutAction struct {
+	run func(runtimeId string) error
+	// newRevision tells whether run creates a helm revision, which is
+	// what a halted rollout rolls back. Restarts that only replace pods
+	// leave the release as it was, so there is nothing to roll back.
+	newRevision bool
+}
+
+// rolloutActions build the action of a rollout from its operation and
+// parameters, so that another replica can resume the rollout
+var rolloutActions = map[string]func(params json.RawMessage) (rolloutAction, error){
+	"restart": func(params json.RawMessage) (rolloutAction, error) {
+		var p struct {
+			Strategy RestartStrategy `json:"strategy"`
+			Timeout  string          `json:"timeout"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return rolloutAction{}, err
+		}
+		return rolloutAction{
+			run: func(runtimeId string) error {
+				return RestartRuntimeWithStrategy(runtimeId, p.Strategy, p.Timeout)
+			},
+			newRevision: p.Strategy == "" || p.Strategy == RestartHelm,
+		}, nil
+	},
+	"upgrade": func(params json.RawMessage) (rolloutAction, error) {
+		var upgrade RuntimeUpgrade
+		if err := json.Unmarshal(params, &upgrade); err != nil {
+			return rolloutAction{}, err
+		}
+		return rolloutAction{
+			run: func(runtimeId string) error {
+				_, err := UpgradeRuntime(runtimeId, upgrade)
+				return err
+			},
+			newRevision: true,
+		}, nil
+	},
+}
+
+// RolloutOptions configures a canary/wave based rollout of a batch operation
+type RolloutOptions struct {
+	// CanarySize is the number of runtimes handled first. Any failure
+	// among them halts the rollout.
+	CanarySize int `json:"canarySize"`
+	// WaveSize is the number of runtimes handled concurrently in each wave
+	// after the canary. Zero means all remaining runtimes in a single wave.
+	WaveSize int `json:"waveSize"`
+	// MaxFailures is the number of failed runtimes tolerated before the
+	// rollout is halted
+	MaxFailures int `json:"maxFailures"`
+	// Rollback rolls the successfully handled runtimes back to their
+	// previous release revision when the rollout is halted
+	Rollback bool `json:"rollback"`
+	// VerifyTimeout bounds how long to wait for the pods of a runtime
+	// to become ready after the operation, e.g. "5m". Defaults to 5m.
+	VerifyTimeout string `json:"verifyTimeout"`
+}
+
+// RolloutRuntimeStatus is the progress of a single runtime in a rollout
+type RolloutRuntimeStatus struct {
+	State    string `json:"state"`
+	Wave     int    `json:"wave"`
+	Error    string `json:"error,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// Rollout tracks a batch operation running in waves. Its state is kept on a
+// Lease owned by the replica running it, so that it can be queried from any
+// replica and taken over if the owner goes away.
+type Rollout struct {
+	ID          string                           `json:"id"`
+	Operation   string                           `json:"operation"`
+	Params      json.RawMessage                  `json:"params"`
+	Timeout     string                           `json:"timeout"`
+	Owner       string                           `json:"owner"`
+	State       string                           `json:"state"`
+	Options     RolloutOptions                   `json:"options"`
+	Waves       [][]string                       `json:"waves"`
+	CurrentWave int                              `json:"currentWave"`
+	Failures    int                              `json:"failures"`
+	Runtimes    map[string]*RolloutRuntimeStatus `json:"runtimes"`
+	StartedAt   time.Time                        `json:"startedAt"`
+	FinishedAt  *time.Time                       `json:"finishedAt,omitempty"`
+
+	mu            sync.Mutex
+	action        rolloutAction
+	verifyTimeout time.Duration
+	lock          *k8s.Lock
+}
+
+var (
+	rolloutsMu sync.Mutex
+	rollouts   = make(map[string]*Rollout)
+)
+
+func newRolloutId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func rolloutLeaseName(id string) string {
+	return "helmapi-rollout-" + id
+}
+
+// planWaves splits the runtime IDs into a canary wave followed by waves of
+// at most waveSize runtimes
+func planWaves(runtimeIds []string, canarySize int, waveSize int) [][]string {
+	waves := [][]string{}
+	remaining := runtimeIds
+
+	if canarySize > 0 {
+		if canarySize > len(remaining) {
+			canarySize = len(remaining)
+		}
+		waves = append(waves, remaining[:canarySize])
+		remaining = remaining[canarySize:]
+	}
+
+	if waveSize <= 0 {
+		waveSize = len(remaining)
+	}
+	for len(remaining) > 0 {
+		if waveSize > len(remaining) {
+			waveSize = len(remaining)
+		}
+		waves = append(waves, remaining[:waveSize])
+		remaining = remaining[waveSize:]
+	}
+
+	return waves
+}
+
+// prepare checks the options of the rollout and builds its action
+func (ro *Rollout) prepare() error {
+	build, ok := rolloutActions[ro.Operation]
+	if !ok {
+		return fmt.Errorf("unknown rollout operation %s", ro.Operation)
+	}
+
+	action, err := build(ro.Params)
+	if err != nil {
+		return err
+	}
+	ro.action = action
+
+	ro.verifyTimeout = 5 * time.Minute
+	if len(ro.Options.VerifyTimeout) > 0 {
+		d, err := time.ParseDuration(ro.Options.VerifyTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid verify timeout: %v", err)
+		}
+		ro.verifyTimeout = d
+	}
+
+	return nil
+}
+
+// InvalidRolloutError is returned by StartRollout when the rollout
+// cannot be started as requested
+type InvalidRolloutError struct {
+	Reason string
+}
+
+func (e *InvalidRolloutError) Error() string {
+	return "invalid rollout: " + e.Reason
+}
+
+// StartRollout runs operation ("restart" or "upgrade", with the given
+// parameters) for every runtime in waves as described by opts, in the
+// background. timeout is passed to helm when rolling back.
+func StartRollout(operation string, params interface{}, runtimeIds []string, opts RolloutOptions, timeout string) (*Rollout, error) {
+	if len(runtimeIds) == 0 {
+		return nil, &InvalidRolloutError{Reason: "you cannot provide an empty runtime list"}
+	}
+
+	seen := make(map[string]bool, len(runtimeIds))
+	for _, runtimeId := range runtimeIds {
+		if seen[runtimeId] {
+			return nil, &InvalidRolloutError{Reason: fmt.Sprintf("runtime %s is listed more than once", runtimeId)}
+		}
+		seen[runtimeId] = true
+	}
+
+	if opts.CanarySize < 0 || opts.WaveSize < 0 || opts.MaxFailures < 0 {
+		return nil, &InvalidRolloutError{Reason: "rollout sizes and failure threshold cannot be negative"}
+	}
+
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ro := &Rollout{
+		ID:        newRolloutId(),
+		Operation: operation,
+		Params:    rawParams,
+		Timeout:   timeout,
+		State:     RolloutRunning,
+		Options:   opts,
+		Waves:     planWaves(runtimeIds, opts.CanarySize, opts.WaveSize),
+		Runtimes:  make(map[string]*RolloutRuntimeStatus, len(runtimeIds)),
+		StartedAt: time.Now(),
+	}
+	for i, wave := range ro.Waves {
+		for _, runtimeId := range wave {
+			ro.Runtimes[runtimeId] = &RolloutRuntimeStatus{State: RuntimePending, Wave: i}
+		}
+	}
+
+	if err := ro.prepare(); err != nil {
+		return nil, &InvalidRolloutError{Reason: err.Error()}
+	}
+
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	ro.lock, err = lm.Acquire(ctx, rolloutLeaseName(ro.ID), map[string]string{LockLabel: "rollout"})
+	if err != nil {
+		return nil, err
+	}
+	ro.Owner = lm.Identity()
+	if err := ro.persist(ctx); err != nil {
+		ro.lock.Delete(ctx)
+		return nil, err
+	}
+
+	track(ro)
+
+	log.Println("Starting", operation, "rollout", ro.ID, "with", len(ro.Waves), "waves")
+	go ro.run()
+
+	return ro, nil
+}
+
+func track(ro *Rollout) {
+	rolloutsMu.Lock()
+	defer rolloutsMu.Unlock()
+
+	for id, old := range rollouts {
+		old.mu.Lock()
+		expired := old.FinishedAt != nil && time.Since(*old.FinishedAt) > finishedRolloutTTL
+		old.mu.Unlock()
+		if expired {
+			delete(rollouts, id)
+		}
+	}
+	rollouts[ro.ID] = ro
+}
+
+// GetRollout returns a snapshot of the rollout with the given ID. Rollouts
+// run by other replicas are read from their lease.
+func GetRollout(id string) (*Rollout, bool) {
+	rolloutsMu.Lock()
+	ro, ok := rollouts[id]
+	rolloutsMu.Unlock()
+	if ok {
+		select {
+		case <-ro.lock.Lost():
+		default:
+			return ro.snapshot(), true
+		}
+	}
+
+	lm, err := k8s.DefaultLeaseManager()
+	if err != nil {
+		log.Println(err)
+		return nil, false
+	}
+
+	lease, err := lm.Get(context.Background(), rolloutLeaseName(id))
+	if err != nil {
+		return nil, false
+	}
+
+	stored, err := rolloutFromLease(lease)
+	if err != nil {
+		log.Println(err)
+		return nil, false
+	}
+
+	return stored, true
+}
+
+func rolloutFromLease(lease *coordv1.Lease) (*Rollout, error) {
+	data, ok := lease.Annotations[rolloutAnnotation]
+	if !ok {
+		return nil, fmt.Errorf("lease %s has no rollout state", lease.Name)
+	}
+
+	var ro Rollout
+	if err := json.Unmarshal([]byte(data), &ro); err != nil {
+		return nil, fmt.Errorf("lease %s has invalid rollout state: %v", lease.Name, err)
+	}
+
+	return &ro, nil
+}
+
+func (ro *Rollout) snapshot() *Rollout {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	runtimes := make(map[string]*RolloutRuntimeStatus, len(ro.Runtimes))
+	for runtimeId, status := range ro.Runtimes {
+		s := *status
+		runtimes[runtimeId] = &s
+	}
+
+	return &Rollout{
+		ID:          ro.ID,
+		Operation:   ro.Operation,
+		Params:      ro.Params,
+		Timeout:     ro.Timeout,
+		Owner:       ro.Owner,
+		State:       ro.State,
+		Options:     ro.Options,
+		Waves:       ro.Waves,
+		CurrentWave: ro.CurrentWave,
+		Failures:    ro.Failures,
+		Runtimes:    runtimes,
+		StartedAt:   ro.StartedAt,
+		FinishedAt:  ro.FinishedAt,
+	}
+}
+
+// persist writes the state of the rollout to its lease
+func (ro *Rollout) persist(ctx context.Context) error {
+	data, err := json.Marshal(ro.snapshot())
+	if err != nil {
+		return err
+	}
+
+	ro.lock.SetAnnotation(rolloutAnnotation, string(data))
+	return ro.lock.Flush(ctx)
+}
+
+func (ro *Rollout) setRuntime(runtimeId string, state string, err error) {
+	ro.mu.Lock()
+	status := ro.Runtimes[runtimeId]
+	status.State = state
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if state == RuntimeFailed {
+		ro.Failures++
+	}
+	ro.mu.Unlock()
+
+	if err := ro.persist(context.Background()); err != nil {
+		log.Println("Could not store state of rollout", ro.ID, err)
+	}
+}
+
+func (ro *Rollout) finish(state string) {
+	ro.mu.Lock()
+	now := time.Now()
+	ro.State = state
+	ro.FinishedAt = &now
+	ro.mu.Unlock()
+
+	ctx := context.Background()
+	if err := ro.persist(ctx); err != nil {
+		log.Println("Could not store state of rollout", ro.ID, err)
+	}
+	if err := ro.lock.Release(ctx); err != nil {
+		log.Println("Could not release lease of rollout", ro.ID, err)
+	}
+
+	log.Println("Rollout", ro.ID, "finished:", state)
+}
+
+// apply runs the action on a single runtime and waits for its pods to be ready
+func (ro *Rollout) apply(runtimeId string) {
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		ro.setRuntime(runtimeId, RuntimeFailed, err)
+		return
+	}
+	ro.mu.Lock()
+	ro.Runtimes[runtimeId].Revision = release.Revision
+	ro.mu.Unlock()
+
+	if err := ro.action.run(runtimeId); err != nil {
+		ro.setRuntime(runtimeId, RuntimeFailed, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ro.verifyTimeout)
+	defer cancel()
+	if err := k8s.WaitForRuntimeReady(ctx, "", runtimeId); err != nil {
+		ro.setRuntime(runtimeId, RuntimeFailed, fmt.Errorf("runtime did not become ready: %v", err))
+		return
+	}
+
+	ro.setRuntime(runtimeId, RuntimeSucceeded, nil)
+}
+
+// run goes through the waves starting at CurrentWave, handling the runtimes
+// that are still pending
+func (ro *Rollout) run() {
+	ro.mu.Lock()
+	start := ro.CurrentWave
+	ro.mu.Unlock()
+
+	for i := start; i < len(ro.Waves); i++ {
+		select {
+		case <-ro.lock.Lost():
+			log.Println("Lost lease of rollout", ro.ID, "- leaving it to another replica")
+			return
+		default:
+		}
+
+		ro.mu.Lock()
+		ro.CurrentWave = i
+		pending := []string{}
+		for _, runtimeId := range ro.Waves[i] {
+			if ro.Runtimes[runtimeId].State == RuntimePending {
+				pending = append(pending, runtimeId)
+			}
+		}
+		ro.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for _, rId := range pending {
+			runtimeId := rId
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ro.apply(runtimeId)
+			}()
+		}
+		wg.Wait()
+
+		ro.mu.Lock()
+		isCanary := i == 0 && ro.Options.CanarySize > 0
+		halt := ro.Failures > ro.Options.MaxFailures || (isCanary && ro.Failures > 0)
+		ro.mu.Unlock()
+
+		if halt {
+			log.Println("Halting rollout", ro.ID, "after wave", i)
+			ro.halt()
+			return
+		}
+	}
+
+	ro.finish(RolloutSucceeded)
+}
+
+// halt skips the pending runtimes and, if requested, rolls back the
+// runtimes that were already handled successfully. Actions that create no
+// helm revision are not rolled back, as that would undo an earlier release.
+func (ro *Rollout) halt() {
+	toRollback := map[string]string{}
+
+	ro.mu.Lock()
+	for runtimeId, status := range ro.Runtimes {
+		switch status.State {
+		case RuntimePending:
+			status.State = RuntimeSkipped
+		case RuntimeSucceeded:
+			toRollback[runtimeId] = status.Revision
+		}
+	}
+	rollback := ro.Options.Rollback && ro.action.newRevision
+	ro.mu.Unlock()
+
+	if err := ro.persist(context.Background()); err != nil {
+		log.Println("Could not store state of rollout", ro.ID, err)
+	}
+
+	if ro.Options.Rollback && !rollback {
+		log.Println("Not rolling back rollout", ro.ID, "as", ro.Operation, "created no helm revisions")
+	}
+	if !rollback {
+		ro.finish(RolloutHalted)
+		return
+	}
+
+	for runtimeId, revision := range toRollback {
+		err := RollbackRuntime(runtimeId, revision, ro.Timeout)
+		if err != nil {
+			ro.mu.Lock()
+			ro.Runtimes[runtimeId].Error = "rollback failed: " + err.Error()
+			ro.mu.Unlock()
+			continue
+		}
+		ro.setRuntime(runtimeId, RuntimeRolledBack, nil)
+	}
+
+	ro.finish(RolloutRolledBack)
+}
+
+// resume takes over a rollout whose owner stopped renewing its lease
+func resume(lm *k8s.LeaseManager, lease *coordv1.Lease) {
+	stored, err := rolloutFromLease(lease)
+	if err != nil || stored.State != RolloutRunning {
+		return
+	}
+
+	ctx := context.Background()
+	lock, err := lm.Acquire(ctx, lease.Name, map[string]string{LockLabel: "rollout"})
+	if err != nil {
+		// Another replica got there first
+		return
+	}
+
+	ro := stored
+	ro.lock = lock
+	ro.Owner = lm.Identity()
+	if err := ro.prepare(); err != nil {
+		log.Println("Could not resume rollout", ro.ID, err)
+		ro.finish(RolloutHalted)
+		return
+	}
+
+	track(ro)
+	log.Println("Resuming rollout", ro.ID, "from wave", ro.CurrentWave)
+
+	halted := false
+	for _, status := range ro.Runtimes {
+		if status.State == RuntimeSkipped {
+			halted = true
+		}
+	}
+	if halted {
+		go ro.halt()
+		return
+	}
+	go ro.run()
+}
+
+// WatchOrphanedRollouts periodically looks for rollouts whose owner stopped
+// renewing their lease and resumes them, and removes the leases of rollouts
+// that finished more than finishedRolloutTTL ago. It never returns.
+func WatchOrphanedRollouts(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		lm, err := k8s.DefaultLeaseManager()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		ctx := context.Background()
+		leases, err := lm.List(ctx, LockLabel+"=rollout")
+		if err != nil {
+			log.Println("Could not list rollout leases", err)
+			continue
+		}
+
+		for i := range leases {
+			lease := &leases[i]
+			if !k8s.LeaseExpired(lease) {
+				continue
+			}
+
+			stored, err := rolloutFromLease(lease)
+			if err == nil && stored.FinishedAt != nil && time.Since(*stored.FinishedAt) > finishedRolloutTTL {
+				if lock, err := lm.Acquire(ctx, lease.Name, nil); err == nil {
+					lock.Delete(ctx)
+				}
+				continue
+			}
+
+			resume(lm, lease)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package client
+
+import "testing"
+
+func TestStartRolloutRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtimeIds []string
+		opts       RolloutOptions
+	}{
+		{"no runtimes", nil, RolloutOptions{}},
+		{"duplicate runtime", []string{"a", "b", "a"}, RolloutOptions{}},
+		{"negative wave size", []string{"a"}, RolloutOptions{WaveSize: -1}},
+		{"bad verify timeout", []string{"a"}, RolloutOptions{VerifyTimeout: "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := StartRollout("restart", struct{}{}, tt.runtimeIds, tt.opts, "")
+			if _, ok := err.(*InvalidRolloutError); !ok {
+				t.Errorf("err = %v, want an InvalidRolloutError", err)
+			}
+		})
+	}
+}
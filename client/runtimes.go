@@ -2,13 +2,16 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
 	"strconv"
-	"strings"
 	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func getChartInfoFromRuntimeId(runtimeId string) (map[string]interface{}, error) {
@@ -50,18 +53,28 @@ func GetInstallRequestFromRuntimeId(runtimeId string) (InstallRequest, error) {
 		return InstallRequest{}, err
 	}
 
+	privateChartsRepo, ok := instanceDetails["privateChartsRepo"].(string)
+	if !ok {
+		return InstallRequest{}, fmt.Errorf("runtime %s has no privateChartsRepo value", runtimeId)
+	}
+
 	var ir InstallRequest
 	ir.ChartName = "mayanr"
 	ir.ReleaseName = "rt-" + runtimeId
-	ir.PrivateChartsRepo = instanceDetails["privateChartsRepo"].(string)
+	ir.PrivateChartsRepo = privateChartsRepo
 	ir.Values = instanceDetails
 	ir.Flags = []string{}
 
 	return ir, nil
 }
 func GetDeleteRequestFromRuntimeId(runtimeId string) (DeleteRequest, error) {
-	// Doing this to make sure that the runtime exists
-	_, err := getChartInfoFromRuntimeId(runtimeId)
+	if len(runtimeId) == 0 {
+		return DeleteRequest{}, fmt.Errorf("you cannot provide an empty runtime ID")
+	}
+
+	// Doing this to make sure that the runtime exists. Fails with
+	// ErrReleaseNotFound if it does not.
+	_, err := getRelease("rt-" + runtimeId)
 	if err != nil {
 		return DeleteRequest{}, err
 	}
@@ -74,15 +87,238 @@ func GetDeleteRequestFromRuntimeId(runtimeId string) (DeleteRequest, error) {
 
 func RestartRuntime(runtimeId string, timeout string) error {
 	log.Println("Attempting to restart runtime", runtimeId)
+	unlock, err := lockRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+	defer unlock()
+
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	if err := checkNotSuspended(context.Background(), release.Namespace, runtimeId); err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
 	values, err := getChartInfoFromRuntimeId(runtimeId)
 	if err != nil {
 		log.Println("Error", runtimeId, err)
 		return err
 	}
-	privateChartsRepo := values["privateChartsRepo"].(string)
 
-	// values["podAnnotations"].(map[string]interface{})["checksum"] = time.Now().Unix()
-	serialisedValues := serializeValues("", values)
+	log.Println("Executing command to restart runtime", runtimeId)
+	err = upgradeRuntimeRelease(runtimeId, values, timeout)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	log.Println("Successfully restarted runtime", runtimeId)
+
+	return nil
+}
+
+// RestartStrategy decides how the pods of a runtime are replaced on restart
+type RestartStrategy string
+
+const (
+	// RestartHelm runs helm upgrade with a new checksum annotation,
+	// which adds a revision to the release history
+	RestartHelm RestartStrategy = "helm"
+
+	// RestartRollout patches the pod template of the runtime workloads,
+	// like kubectl rollout restart
+	RestartRollout RestartStrategy = "rollout"
+
+	// RestartDeletePods deletes the runtime pods and lets them be recreated
+	RestartDeletePods RestartStrategy = "delete-pods"
+)
+
+// RestartRuntimeWithStrategy restarts a runtime with the given strategy and
+// waits until its pods have been replaced and are ready. An empty strategy
+// means RestartHelm.
+func RestartRuntimeWithStrategy(runtimeId string, strategy RestartStrategy, timeout string) error {
+	if strategy == "" || strategy == RestartHelm {
+		return RestartRuntime(runtimeId, timeout)
+	}
+
+	if strategy != RestartRollout && strategy != RestartDeletePods {
+		return &InvalidRequestError{RuntimeId: runtimeId, Reason: fmt.Sprintf("unknown restart strategy %s", strategy)}
+	}
+
+	wait := 5 * time.Minute
+	if len(timeout) > 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return &InvalidRequestError{RuntimeId: runtimeId, Reason: fmt.Sprintf("invalid timeout: %v", err)}
+		}
+		wait = d
+	}
+
+	log.Println("Attempting to restart runtime", runtimeId, "with strategy", strategy)
+	unlock, err := lockRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+	defer unlock()
+
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	if err := checkNotSuspended(ctx, release.Namespace, runtimeId); err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	since := time.Now()
+	if strategy == RestartRollout {
+		err = k8s.RolloutRestartRuntime(ctx, "", runtimeId)
+	} else {
+		err = k8s.DeleteRuntimePods(ctx, "", runtimeId)
+	}
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	err = k8s.WaitForRuntimeReplaced(ctx, "", runtimeId, since)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return fmt.Errorf("runtime did not become ready: %v", err)
+	}
+
+	log.Println("Successfully restarted runtime", runtimeId)
+	return nil
+}
+
+// RuntimeUpgrade describes how the release of a runtime should be changed
+type RuntimeUpgrade struct {
+	// ChartVersion is the mayanr version to move to. If empty, the runtime
+	// stays on the version it is currently running.
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// PrivateChartsRepo replaces the repo the chart is pulled from, if set
+	PrivateChartsRepo string          `json:"privateChartsRepo,omitempty"`
+	Values            json.RawMessage `json:"values,omitempty"`
+	Strategy          MergeStrategy   `json:"strategy,omitempty"`
+	Timeout           string          `json:"timeout,omitempty"`
+	DryRun            bool            `json:"dryRun,omitempty"`
+}
+
+// RuntimeUpgradeResult reports what an upgrade did to a runtime
+type RuntimeUpgradeResult struct {
+	OldChartVersion string                 `json:"oldChartVersion"`
+	NewChartVersion string                 `json:"newChartVersion"`
+	Values          map[string]interface{} `json:"values"`
+}
+
+// UpgradeRuntime moves the release of a runtime to a new chart version
+// and/or applies a values patch to it using the given merge strategy.
+// The effective values are returned with secrets shown as the references
+// they were resolved from. With DryRun set, the release is left untouched.
+func UpgradeRuntime(runtimeId string, upgrade RuntimeUpgrade) (RuntimeUpgradeResult, error) {
+	log.Println("Attempting to upgrade runtime", runtimeId)
+	if !upgrade.DryRun {
+		unlock, err := lockRelease("rt-" + runtimeId)
+		if err != nil {
+			log.Println("Error", runtimeId, err)
+			return RuntimeUpgradeResult{}, err
+		}
+		defer unlock()
+	}
+
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return RuntimeUpgradeResult{}, err
+	}
+
+	ir, err := GetInstallRequestFromRuntimeId(runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return RuntimeUpgradeResult{}, err
+	}
+
+	if !upgrade.DryRun {
+		if err := checkNotSuspended(context.Background(), release.Namespace, runtimeId); err != nil {
+			log.Println("Error", runtimeId, err)
+			return RuntimeUpgradeResult{}, err
+		}
+	}
+
+	merged, err := MergeValues(restoreSecretRefs(ir.Values), upgrade.Values, upgrade.Strategy)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return RuntimeUpgradeResult{}, &InvalidRequestError{RuntimeId: runtimeId, Reason: err.Error()}
+	}
+
+	if len(upgrade.PrivateChartsRepo) > 0 {
+		merged["privateChartsRepo"] = upgrade.PrivateChartsRepo
+	}
+	ir.PrivateChartsRepo, _ = merged["privateChartsRepo"].(string)
+	ir.Values = merged
+
+	result := RuntimeUpgradeResult{
+		OldChartVersion: release.ChartVersion(ir.ChartName),
+		NewChartVersion: upgrade.ChartVersion,
+		Values:          merged,
+	}
+	if len(result.NewChartVersion) == 0 {
+		result.NewChartVersion = result.OldChartVersion
+	}
+
+	if upgrade.DryRun {
+		return result, nil
+	}
+
+	ir.Flags = append(ir.Flags, "--version", result.NewChartVersion, "--wait")
+	if len(upgrade.Timeout) > 0 {
+		ir.Flags = append(ir.Flags, "--timeout", upgrade.Timeout)
+	}
+
+	log.Println("Executing command to upgrade runtime", runtimeId)
+	err = ir.install()
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return RuntimeUpgradeResult{}, err
+	}
+
+	release, err = getRelease(ir.ReleaseName)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return RuntimeUpgradeResult{}, err
+	}
+	result.NewChartVersion = release.ChartVersion(ir.ChartName)
+
+	log.Println("Successfully upgraded runtime", runtimeId)
+
+	return result, nil
+}
+
+// upgradeRuntimeRelease runs helm upgrade on the release of a runtime with
+// the given values, bumping the checksum annotation so the pods are recreated
+func upgradeRuntimeRelease(runtimeId string, values map[string]interface{}, timeout string) error {
+	privateChartsRepo, ok := values["privateChartsRepo"].(string)
+	if !ok {
+		return fmt.Errorf("runtime %s has no privateChartsRepo value", runtimeId)
+	}
+
+	valuesArgs, cleanup, err := helmValuesArgs("rt-"+runtimeId, values)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	app := "helm"
 	args := []string{
@@ -91,13 +327,11 @@ func RestartRuntime(runtimeId string, timeout string) error {
 		"mayanr",
 		"--repo",
 		privateChartsRepo,
-		"--set",
-		strings.Join(serialisedValues, ",") + ",podAnnotations.checksum=v" + strconv.FormatInt(time.Now().Unix(), 10),
-		"--timeout",
-		timeout,
-		"--wait",
-		"-o",
-		"json",
+	}
+	args = append(args, valuesArgs...)
+	args = append(args, "--wait", "-o", "json")
+	if len(timeout) > 0 {
+		args = append(args, "--timeout", timeout)
 	}
 
 	cmd := exec.Command(app, args...)
@@ -105,13 +339,200 @@ func RestartRuntime(runtimeId string, timeout string) error {
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
 
-	log.Println("Executing command to restart runtime", runtimeId)
-	err = cmd.Run()
+	return cmd.Run()
+}
+
+// RollbackRuntime rolls the release of a runtime back to the given revision
+func RollbackRuntime(runtimeId string, revision string, timeout string) error {
+	if len(revision) > 0 {
+		if n, err := strconv.Atoi(revision); err != nil || n < 1 {
+			return &InvalidRequestError{RuntimeId: runtimeId, Reason: fmt.Sprintf("invalid revision %s", revision)}
+		}
+	}
+
+	log.Println("Attempting to roll back runtime", runtimeId, "to revision", revision)
+	unlock, err := lockRelease("rt-" + runtimeId)
 	if err != nil {
+		log.Println("Error", runtimeId, err)
 		return err
 	}
+	defer unlock()
 
-	log.Println("Successfully restarted runtime", runtimeId)
+	if _, err := getRelease("rt-" + runtimeId); err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	app := "helm"
+	// Without a revision, helm rolls back to the previous one
+	args := []string{"rollback", "rt-" + runtimeId}
+	if len(revision) > 0 {
+		args = append(args, revision)
+	}
+	args = append(args, "--wait")
+	if len(timeout) > 0 {
+		args = append(args, "--timeout", timeout)
+	}
+
+	cmd := exec.Command(app, args...)
+	if err := execute(cmd); err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	log.Println("Successfully rolled back runtime", runtimeId)
+	return nil
+}
+
+// RuntimeSpec describes a runtime to be created
+type RuntimeSpec struct {
+	RuntimeId         string                 `json:"runtimeId"`
+	Owner             string                 `json:"owner"`
+	PrivateChartsRepo string                 `json:"privateChartsRepo"`
+	Values            map[string]interface{} `json:"values"`
+}
+
+// InvalidSpecError is returned for a RuntimeSpec that cannot be installed
+type InvalidSpecError struct {
+	RuntimeId string
+	Reason    string
+}
+
+func (e *InvalidSpecError) Error() string {
+	return fmt.Sprintf("invalid spec of runtime %s: %s", e.RuntimeId, e.Reason)
+}
+
+// RuntimeExistsError is returned by CreateRuntime for a runtime that is
+// already installed
+type RuntimeExistsError struct {
+	RuntimeId string
+}
+
+func (e *RuntimeExistsError) Error() string {
+	return fmt.Sprintf("runtime %s already exists", e.RuntimeId)
+}
+
+// InvalidRequestError is returned when an operation on an existing runtime
+// is asked for with invalid parameters
+type InvalidRequestError struct {
+	RuntimeId string
+	Reason    string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return fmt.Sprintf("invalid request for runtime %s: %s", e.RuntimeId, e.Reason)
+}
+
+// Validate checks that the spec can be installed: rt-<runtimeId> must be a
+// valid release name, and the owner a valid label value since runtime pods
+// are listed by it
+func (rs *RuntimeSpec) Validate() error {
+	if len(rs.RuntimeId) == 0 {
+		return &InvalidSpecError{Reason: "you cannot provide an empty runtime ID"}
+	}
+	releaseName := "rt-" + rs.RuntimeId
+	if len(releaseName) > ReleaseNameMaxLength {
+		return &InvalidSpecError{RuntimeId: rs.RuntimeId, Reason: fmt.Sprintf("runtime ID must be at most %d characters", ReleaseNameMaxLength-len("rt-"))}
+	}
+	if errs := validation.IsDNS1123Subdomain(releaseName); len(errs) > 0 {
+		return &InvalidSpecError{RuntimeId: rs.RuntimeId, Reason: errs[0]}
+	}
+
+	if len(rs.Owner) == 0 || len(rs.PrivateChartsRepo) == 0 {
+		return &InvalidSpecError{RuntimeId: rs.RuntimeId, Reason: "owner or privateChartsRepo cannot be empty"}
+	}
+	if errs := validation.IsValidLabelValue(rs.Owner); len(errs) > 0 {
+		return &InvalidSpecError{RuntimeId: rs.RuntimeId, Reason: "owner: " + errs[0]}
+	}
+	return nil
+}
+
+// GetInstallRequest builds the InstallRequest for a new runtime. The values
+// are the server side template, overridden by the values of the spec, with
+// the labels that runtime pods are listed by always set.
+func (rs *RuntimeSpec) GetInstallRequest() (InstallRequest, error) {
+	if err := rs.Validate(); err != nil {
+		return InstallRequest{}, err
+	}
+
+	defaults, err := loadRuntimeTemplate()
+	if err != nil {
+		return InstallRequest{}, err
+	}
+
+	defaults, err = renderValues(defaults, runtimeTemplateData{RuntimeId: rs.RuntimeId, Owner: rs.Owner})
+	if err != nil {
+		return InstallRequest{}, err
+	}
+
+	values := overlayValues(defaults, rs.Values)
+	values = overlayValues(values, map[string]interface{}{
+		"privateChartsRepo": rs.PrivateChartsRepo,
+		"podLabels": map[string]interface{}{
+			"userRuntimeOwner": rs.Owner,
+			"mayaResourceType": "userRuntime",
+		},
+	})
+
+	var ir InstallRequest
+	ir.ChartName = "mayanr"
+	ir.ReleaseName = "rt-" + rs.RuntimeId
+	ir.PrivateChartsRepo = rs.PrivateChartsRepo
+	ir.Values = values
+	ir.Flags = []string{}
+
+	return ir, nil
+}
+
+// CreateRuntime installs a new runtime. It fails if the runtime already exists.
+func CreateRuntime(rs RuntimeSpec, timeout string) error {
+	log.Println("Attempting to create runtime", rs.RuntimeId)
+	ir, err := rs.GetInstallRequest()
+	if err != nil {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
+
+	unlockOwner, err := lockOwner(rs.Owner)
+	if err != nil {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
+	defer unlockOwner()
+
+	unlock, err := lockRelease(ir.ReleaseName)
+	if err != nil {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
+	defer unlock()
+
+	_, err = getRelease(ir.ReleaseName)
+	if err == nil {
+		return &RuntimeExistsError{RuntimeId: rs.RuntimeId}
+	}
+	if err != ErrReleaseNotFound {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
+
+	err = checkQuota(context.Background(), rs.Owner, ir.Values)
+	if err != nil {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
+
+	ir.Flags = append(ir.Flags, "--wait")
+	if len(timeout) > 0 {
+		ir.Flags = append(ir.Flags, "--timeout", timeout)
+	}
+
+	err = ir.install()
+	if err != nil {
+		log.Println("Error", rs.RuntimeId, err)
+		return err
+	}
 
+	log.Println("Successfully created runtime", rs.RuntimeId)
 	return nil
 }
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// secretRefKey marks a values entry that should be resolved from a
+	// Kubernetes Secret, e.g. {"$secretRef": {"name": "db", "key": "password"}}
+	secretRefKey = "$secretRef"
+
+	// secretRefsValuesKey is the release value under which the original
+	// references are recorded, so that they can be resolved again on restart
+	secretRefsValuesKey = "helmapiSecretRefs"
+
+	// releaseSecretLabel names the release a Secret of resolved values
+	// belongs to
+	releaseSecretLabel = "helmapi.mayahq.com/release"
+)
+
+// SecretRef points to a single key of a Kubernetes Secret
+type SecretRef struct {
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// parseSecretRef checks whether val is a {"$secretRef": {...}} object and
+// returns the reference it contains
+func parseSecretRef(val map[string]interface{}) (SecretRef, bool, error) {
+	raw, ok := val[secretRefKey]
+	if !ok {
+		return SecretRef{}, false, nil
+	}
+
+	if len(val) != 1 {
+		return SecretRef{}, true, fmt.Errorf("%s cannot have sibling keys", secretRefKey)
+	}
+
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return SecretRef{}, true, fmt.Errorf("%s must be an object", secretRefKey)
+	}
+
+	var ref SecretRef
+	ref.Name, _ = fields["name"].(string)
+	ref.Key, _ = fields["key"].(string)
+	ref.Namespace, _ = fields["namespace"].(string)
+
+	if len(ref.Name) == 0 || len(ref.Key) == 0 {
+		return SecretRef{}, true, fmt.Errorf("%s requires a secret name and key", secretRefKey)
+	}
+
+	return ref, true, nil
+}
+
+// secretResolver reads the value a reference points to
+type secretResolver func(ctx context.Context, ref SecretRef) (string, error)
+
+// resolveFromCluster reads references from the Secrets in the cluster
+func resolveFromCluster(ctx context.Context, ref SecretRef) (string, error) {
+	return k8s.GetSecretValue(ctx, ref.Namespace, ref.Name, ref.Key)
+}
+
+// releaseSecretName is the name of the Secret that holds the resolved
+// secret values of a release
+func releaseSecretName(releaseName string) string {
+	return "helmapi-values-" + releaseName
+}
+
+// resolveSecretRefs splits values into a copy in which every secret
+// reference is replaced by a secretKeyRef into the Secret secretName, and
+// the values read for the references, keyed by their path in values. It
+// returns a tree of the references that were found as well, mirroring
+// the structure of values.
+func resolveSecretRefs(ctx context.Context, prefix string, values map[string]interface{}, secretName string, resolve secretResolver) (map[string]interface{}, map[string][]byte, map[string]interface{}, error) {
+	plain := make(map[string]interface{}, len(values))
+	secrets := make(map[string][]byte)
+	refs := make(map[string]interface{})
+
+	for key, val := range values {
+		nested, ok := val.(map[string]interface{})
+		if !ok {
+			plain[key] = val
+			continue
+		}
+
+		ref, isRef, err := parseSecretRef(nested)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid value at %s: %v", prefix+key, err)
+		}
+
+		if isRef {
+			path := prefix + key
+			if errs := validation.IsConfigMapKey(path); len(errs) > 0 {
+				return nil, nil, nil, fmt.Errorf("invalid value at %s: %s cannot be used as a secret key", path, path)
+			}
+
+			secretVal, err := resolve(ctx, ref)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("could not resolve secret for %s: %v", path, err)
+			}
+			secrets[path] = []byte(secretVal)
+			refs[key] = nested
+			plain[key] = map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{
+					"name": secretName,
+					"key":  path,
+				},
+			}
+			continue
+		}
+
+		nestedPlain, nestedSecrets, nestedRefs, err := resolveSecretRefs(ctx, prefix+key+".", nested, secretName, resolve)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		plain[key] = nestedPlain
+		for path, secretVal := range nestedSecrets {
+			secrets[path] = secretVal
+		}
+		if len(nestedRefs) > 0 {
+			refs[key] = nestedRefs
+		}
+	}
+
+	return plain, secrets, refs, nil
+}
+
+// overlayValues returns a copy of base with the entries of overlay deep
+// merged on top of it
+func overlayValues(base map[string]interface{}, overlay map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base))
+	for key, val := range base {
+		result[key] = val
+	}
+
+	for key, val := range overlay {
+		overlayMap, overlayIsMap := val.(map[string]interface{})
+		baseMap, baseIsMap := result[key].(map[string]interface{})
+		if overlayIsMap && baseIsMap {
+			if _, isRef := overlayMap[secretRefKey]; !isRef {
+				result[key] = overlayValues(baseMap, overlayMap)
+				continue
+			}
+		}
+		result[key] = val
+	}
+
+	return result
+}
+
+// restoreSecretRefs puts the references recorded in a previous release back in
+// place of the values they were resolved to, so the result is safe to show
+func restoreSecretRefs(values map[string]interface{}) map[string]interface{} {
+	recorded, ok := values[secretRefsValuesKey].(map[string]interface{})
+	if !ok {
+		return values
+	}
+
+	withRefs := overlayValues(values, recorded)
+	delete(withRefs, secretRefsValuesKey)
+	return withRefs
+}
+
+// prepareValues resolves the secret references in values (including the ones
+// recorded in a previous release) for the release releaseName. It returns
+// the values to give helm, which point to the release Secret instead of
+// holding secrets and record the references under secretRefsValuesKey, and
+// the data of the release Secret separately.
+func prepareValues(ctx context.Context, releaseName string, values map[string]interface{}, resolve secretResolver) (map[string]interface{}, map[string][]byte, error) {
+	withRefs := restoreSecretRefs(values)
+
+	plain, secrets, refs, err := resolveSecretRefs(ctx, "", withRefs, releaseSecretName(releaseName), resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(refs) > 0 {
+		plain[secretRefsValuesKey] = refs
+	}
+
+	return plain, secrets, nil
+}
+
+// helmValuesArgs returns the arguments that pass values to helm upgrade for
+// the release releaseName. Resolved secrets are written to the release
+// Secret and never reach helm, so they do not show in the release values;
+// the chart reads them through the secretKeyRef objects that take the place
+// of the references. Values go in a file so that lists and nulls reach helm
+// as they are, which --set cannot express. A checksum annotation set on the
+// command line makes the pods roll. cleanup removes the file and must be
+// called once helm is done.
+func helmValuesArgs(releaseName string, values map[string]interface{}) ([]string, func(), error) {
+	ctx := context.Background()
+	plain, secrets, err := prepareValues(ctx, releaseName, values, resolveFromCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(secrets) > 0 {
+		labels := map[string]string{releaseSecretLabel: releaseName}
+		err = k8s.ApplySecret(ctx, "", releaseSecretName(releaseName), labels, secrets)
+	} else {
+		err = k8s.DeleteSecret(ctx, "", releaseSecretName(releaseName))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not store secrets of release %s: %v", releaseName, err)
+	}
+
+	// JSON is valid YAML, which is what helm expects in -f
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := ioutil.TempFile("", "helmapi-values-*.yaml")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		os.Remove(f.Name())
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	pac := "podAnnotations.checksum=v" + strconv.FormatInt(time.Now().Unix(), 10)
+	return []string{"-f", f.Name(), "--set", pac}, cleanup, nil
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrepareValuesKeepsSecretsOut(t *testing.T) {
+	resolve := func(ctx context.Context, ref SecretRef) (string, error) {
+		return ref.Name + "-" + ref.Key + "-s3cret", nil
+	}
+	values := map[string]interface{}{
+		"replicas": 1,
+		"db": map[string]interface{}{
+			"password": map[string]interface{}{secretRefKey: map[string]interface{}{"name": "db", "key": "password"}},
+		},
+	}
+
+	plain, secrets, err := prepareValues(context.Background(), "rt-1", values, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("helm values hold a resolved secret: %s", data)
+	}
+
+	wantRef := map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "helmapi-values-rt-1", "key": "db.password"}}
+	if got := plain["db"].(map[string]interface{})["password"]; !reflect.DeepEqual(got, wantRef) {
+		t.Errorf("db.password = %v, want %v", got, wantRef)
+	}
+	wantSecrets := map[string][]byte{"db.password": []byte("db-password-s3cret")}
+	if !reflect.DeepEqual(secrets, wantSecrets) {
+		t.Errorf("secrets = %q, want %q", secrets, wantSecrets)
+	}
+
+	// A restart starts from the values of the release and resolves the
+	// recorded references again
+	again, secretsAgain, err := prepareValues(context.Background(), "rt-1", plain, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, plain) || !reflect.DeepEqual(secretsAgain, secrets) {
+		t.Errorf("restart gave %v and %q, want %v and %q", again, secretsAgain, plain, secrets)
+	}
+
+	shown := restoreSecretRefs(plain)
+	if !reflect.DeepEqual(shown["db"], values["db"]) {
+		t.Errorf("restored db = %v, want the reference back", shown["db"])
+	}
+}
+
+func TestPrepareValuesRejectsBadSecretKey(t *testing.T) {
+	resolve := func(ctx context.Context, ref SecretRef) (string, error) {
+		return "s3cret", nil
+	}
+	values := map[string]interface{}{
+		"db/primary": map[string]interface{}{secretRefKey: map[string]interface{}{"name": "db", "key": "password"}},
+	}
+
+	if _, _, err := prepareValues(context.Background(), "rt-1", values, resolve); err == nil {
+		t.Error("want an error for a path that is not a valid secret key")
+	}
+}
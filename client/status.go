@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+// Overall states of a runtime
+const (
+	RuntimeStateRunning     = "Running"
+	RuntimeStateProgressing = "Progressing"
+	RuntimeStateDegraded    = "Degraded"
+	RuntimeStateFailed      = "Failed"
+	RuntimeStateMissing     = "Missing"
+	RuntimeStateSuspended   = "Suspended"
+)
+
+// degradedReasons are pod status reasons that will not go away on their own
+var degradedReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"OOMKilled":                  true,
+	"Error":                      true,
+	"Evicted":                    true,
+}
+
+// RuntimeStatus combines the helm release of a runtime with its pods
+type RuntimeStatus struct {
+	State         string           `json:"state"`
+	ReleaseStatus string           `json:"releaseStatus,omitempty"`
+	Revision      string           `json:"revision,omitempty"`
+	ChartVersion  string           `json:"chartVersion,omitempty"`
+	Updated       string           `json:"updated,omitempty"`
+	SuspendedAt   *time.Time       `json:"suspendedAt,omitempty"`
+	Pods          []k8s.PodSummary `json:"pods"`
+}
+
+// computeRuntimeState derives the overall state of a runtime from the status
+// of its release and the summaries of its pods
+func computeRuntimeState(releaseStatus string, pods []k8s.PodSummary) string {
+	switch releaseStatus {
+	case "failed":
+		return RuntimeStateFailed
+	case "pending-install", "pending-upgrade", "pending-rollback", "uninstalling":
+		return RuntimeStateProgressing
+	}
+
+	if len(pods) == 0 {
+		return RuntimeStateDegraded
+	}
+
+	ready := true
+	for _, pod := range pods {
+		crashed := degradedReasons[pod.LastTerminationReason] && !pod.Ready
+		if pod.Status == "Failed" || degradedReasons[pod.StatusReason] || crashed {
+			return RuntimeStateDegraded
+		}
+		if !pod.Ready {
+			ready = false
+		}
+	}
+
+	if ready {
+		return RuntimeStateRunning
+	}
+	return RuntimeStateProgressing
+}
+
+// GetRuntimeStatus reports the release of a runtime, its pods and
+// the overall state computed from both
+func GetRuntimeStatus(ctx context.Context, runtimeId string) (RuntimeStatus, error) {
+	release, err := getRelease("rt-" + runtimeId)
+	if err == ErrReleaseNotFound {
+		return RuntimeStatus{State: RuntimeStateMissing, Pods: []k8s.PodSummary{}}, nil
+	}
+	if err != nil {
+		return RuntimeStatus{}, err
+	}
+
+	selector, err := k8s.RuntimeSelector(runtimeId)
+	if err != nil {
+		return RuntimeStatus{}, err
+	}
+
+	pods, err := k8s.ListRuntimePods(ctx, k8s.PodQuery{
+		Namespace: release.Namespace,
+		Selector:  selector,
+	})
+	if err != nil {
+		return RuntimeStatus{}, err
+	}
+
+	suspend, err := k8s.GetSuspendState(ctx, release.Namespace, runtimeId)
+	if err != nil {
+		return RuntimeStatus{}, err
+	}
+
+	state := computeRuntimeState(release.Status, pods.Pods)
+	if suspend.Suspended && release.Status == "deployed" {
+		state = RuntimeStateSuspended
+	}
+
+	return RuntimeStatus{
+		State:         state,
+		ReleaseStatus: release.Status,
+		Revision:      release.Revision,
+		ChartVersion:  release.ChartVersion("mayanr"),
+		Updated:       release.Updated,
+		SuspendedAt:   suspend.SuspendedAt,
+		Pods:          pods.Pods,
+	}, nil
+}
+
+// ListRuntimes lists the runtimes that have pods matching query, built from
+// all of their pods, so the query is not paged
+func ListRuntimes(ctx context.Context, query k8s.PodQuery) (RuntimeList, error) {
+	query.Limit = 0
+	query.Continue = ""
+
+	pods, err := k8s.ListRuntimePods(ctx, query)
+	if err != nil {
+		return RuntimeList{}, err
+	}
+
+	byId := make(map[string]*RuntimeSummary)
+	for _, pod := range pods.Pods {
+		if len(pod.RuntimeId) == 0 {
+			continue
+		}
+		summary, ok := byId[pod.RuntimeId]
+		if !ok {
+			summary = &RuntimeSummary{RuntimeId: pod.RuntimeId, OwnerId: pod.OwnerId, Namespace: pod.Namespace}
+			byId[pod.RuntimeId] = summary
+		}
+		summary.Pods++
+		if pod.Ready {
+			summary.ReadyPods++
+		}
+	}
+
+	runtimes := make([]RuntimeSummary, 0, len(byId))
+	for _, summary := range byId {
+		runtimes = append(runtimes, *summary)
+	}
+	sort.Slice(runtimes, func(i, j int) bool {
+		return runtimes[i].RuntimeId < runtimes[j].RuntimeId
+	})
+
+	return RuntimeList{Runtimes: runtimes, Freshness: pods.Freshness}, nil
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dush-t/helmapi/client/k8s"
+)
+
+// checkNotSuspended fails for suspended runtimes. A helm upgrade would bring
+// back the replicas of the chart while the runtime still looks suspended.
+func checkNotSuspended(ctx context.Context, namespace string, runtimeId string) error {
+	state, err := k8s.GetSuspendState(ctx, namespace, runtimeId)
+	if err != nil {
+		return err
+	}
+	if state.Suspended {
+		return fmt.Errorf("runtime %s is suspended, resume it first", runtimeId)
+	}
+	return nil
+}
+
+// SuspendRuntime scales the workloads of a runtime to zero replicas. The
+// rt-<runtimeId> release and its values are kept as they are.
+func SuspendRuntime(runtimeId string) error {
+	log.Println("Attempting to suspend runtime", runtimeId)
+	unlock, err := lockRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+	defer unlock()
+
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	err = k8s.SuspendRuntime(context.Background(), release.Namespace, runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	log.Println("Successfully suspended runtime", runtimeId)
+	return nil
+}
+
+// ResumeRuntime restores the replicas of a suspended runtime and waits for
+// its pods to become ready, for at most timeout (5m if empty)
+func ResumeRuntime(runtimeId string, timeout string) error {
+	wait := 5 * time.Minute
+	if len(timeout) > 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return &InvalidRequestError{RuntimeId: runtimeId, Reason: fmt.Sprintf("invalid timeout: %v", err)}
+		}
+		wait = d
+	}
+
+	log.Println("Attempting to resume runtime", runtimeId)
+	unlock, err := lockRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+	defer unlock()
+
+	release, err := getRelease("rt-" + runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	err = k8s.ResumeRuntime(ctx, release.Namespace, runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return err
+	}
+
+	err = k8s.WaitForRuntimeReady(ctx, release.Namespace, runtimeId)
+	if err != nil {
+		log.Println("Error", runtimeId, err)
+		return fmt.Errorf("runtime did not become ready: %v", err)
+	}
+
+	log.Println("Successfully resumed runtime", runtimeId)
+	return nil
+}
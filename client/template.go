@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// runtimeTemplateEnv names the environment variable holding the path of a
+// JSON file with the default values of new runtimes. String values in it
+// can use {{ .RuntimeId }} and {{ .Owner }}.
+const runtimeTemplateEnv = "RUNTIME_VALUES_TEMPLATE"
+
+// runtimeTemplateData is what the strings of the values template are
+// rendered with
+type runtimeTemplateData struct {
+	RuntimeId string
+	Owner     string
+}
+
+// loadRuntimeTemplate reads the values template. It is read on every call so
+// that changes to a mounted ConfigMap are picked up without a restart.
+func loadRuntimeTemplate() (map[string]interface{}, error) {
+	path := os.Getenv(runtimeTemplateEnv)
+	if len(path) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values map[string]interface{}
+	err = json.NewDecoder(f).Decode(&values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// renderValues returns a copy of values with every string executed as a
+// text/template against data
+func renderValues(values map[string]interface{}, data runtimeTemplateData) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(values))
+
+	for key, val := range values {
+		switch v := val.(type) {
+		case string:
+			if !strings.Contains(v, "{{") {
+				result[key] = v
+				continue
+			}
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(v)
+			if err != nil {
+				return nil, err
+			}
+			var out bytes.Buffer
+			err = tmpl.Execute(&out, data)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = out.String()
+		case map[string]interface{}:
+			nested, err := renderValues(v, data)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = nested
+		default:
+			result[key] = val
+		}
+	}
+
+	return result, nil
+}
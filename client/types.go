@@ -1 +1,28 @@
 package client
+
+import "github.com/dush-t/helmapi/client/k8s"
+
+// Types below are the bodies the HTTP API responds with. They live here so
+// that the server and its clients share them.
+
+// ErrorResponse is the body of failed requests that explain themselves.
+// Details lists every problem found when a request does not match the spec.
+type ErrorResponse struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+// RuntimeSummary is a runtime as seen from its pods
+type RuntimeSummary struct {
+	RuntimeId string `json:"runtimeId"`
+	OwnerId   string `json:"ownerId"`
+	Namespace string `json:"namespace"`
+	Pods      int    `json:"pods"`
+	ReadyPods int    `json:"readyPods"`
+}
+
+// RuntimeList is the body of GET /v1/runtimes
+type RuntimeList struct {
+	Runtimes  []RuntimeSummary `json:"runtimes"`
+	Freshness *k8s.Freshness   `json:"freshness,omitempty"`
+}
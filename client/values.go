@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// MergeStrategy decides how a values patch is combined with the
+// values of an existing release
+type MergeStrategy string
+
+const (
+	// ReuseValues deep merges the patch into the current values,
+	// like helm upgrade --reuse-values
+	ReuseValues MergeStrategy = "reuse-values"
+
+	// MergePatch applies the patch as a JSON merge patch (RFC 7386),
+	// so null removes a key
+	MergePatch MergeStrategy = "merge-patch"
+
+	// JSONPatch applies the patch as a list of JSON patch operations (RFC 6902)
+	JSONPatch MergeStrategy = "json-patch"
+
+	// ReplaceValues throws away the current values and uses the patch as is
+	ReplaceValues MergeStrategy = "replace"
+)
+
+// MergeValues returns the values that result from applying patch
+// to current with the given strategy. An empty strategy means ReuseValues.
+func MergeValues(current map[string]interface{}, patch json.RawMessage, strategy MergeStrategy) (map[string]interface{}, error) {
+	if len(patch) == 0 {
+		if strategy == ReplaceValues {
+			return map[string]interface{}{}, nil
+		}
+		return current, nil
+	}
+
+	switch strategy {
+	case ReuseValues, "":
+		var patchValues map[string]interface{}
+		if err := json.Unmarshal(patch, &patchValues); err != nil {
+			return nil, fmt.Errorf("values patch must be an object: %v", err)
+		}
+		return overlayValues(current, patchValues), nil
+
+	case ReplaceValues:
+		var values map[string]interface{}
+		if err := json.Unmarshal(patch, &values); err != nil {
+			return nil, fmt.Errorf("values patch must be an object: %v", err)
+		}
+		return values, nil
+
+	case MergePatch:
+		currentJSON, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+		mergedJSON, err := jsonpatch.MergePatch(currentJSON, patch)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply merge patch: %v", err)
+		}
+		return unmarshalValues(mergedJSON)
+
+	case JSONPatch:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, fmt.Errorf("values patch must be a list of operations: %v", err)
+		}
+		currentJSON, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+		patchedJSON, err := ops.Apply(currentJSON)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply json patch: %v", err)
+		}
+		return unmarshalValues(patchedJSON)
+	}
+
+	return nil, fmt.Errorf("unknown merge strategy %s", strategy)
+}
+
+func unmarshalValues(data []byte) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("patched values must be an object: %v", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return values, nil
+}
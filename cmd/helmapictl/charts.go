@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/dush-t/helmapi/client"
+	"sigs.k8s.io/yaml"
+)
+
+// readValues merges YAML values files in order, later files winning like
+// helm -f does
+func readValues(files []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not read values from %s: %v", file, err)
+		}
+		if string(patch) == "null" {
+			continue
+		}
+		if values, err = client.MergeValues(values, patch, client.ReuseValues); err != nil {
+			return nil, fmt.Errorf("could not read values from %s: %v", file, err)
+		}
+	}
+	return values, nil
+}
+
+func installCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	var valuesFiles, helmFlags stringList
+	fs := newFlagSet("install <release> <chart>", &g)
+	repo := fs.String("repo", "", "Repo URL of the chart")
+	fs.Var(&valuesFiles, "f", "YAML values file, can be repeated")
+	fs.Var(&helmFlags, "flag", "Extra helm flag, can be repeated")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("install needs a release name and a chart")
+	}
+
+	values, err := readValues(valuesFiles)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	ir := client.InstallRequest{
+		ReleaseName:       positional[0],
+		ChartName:         positional[1],
+		PrivateChartsRepo: *repo,
+		Values:            values,
+		Flags:             helmFlags,
+	}
+	result := newBatchResult("installed")
+	result.record(ir.ReleaseName, c.Install(ctx, ir))
+	return result.print(out, g.output, "release")
+}
+
+func deleteCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("delete <release>...", &g)
+	timeout := fs.String("timeout", "", "helm --timeout, e.g. 5m")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("delete needs a release name")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	result := newBatchResult("deleted")
+	for _, name := range positional {
+		result.record(name, c.DeleteRelease(ctx, name, *timeout))
+	}
+	return result.print(out, g.output, "release")
+}
+
+func repoAddCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("repo add <name> <url>", &g)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("repo add needs a name and a URL")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	result := newBatchResult("added")
+	result.record(positional[0], c.AddRepo(ctx, client.RepoAddRequest{Name: positional[0], URL: positional[1]}))
+	return result.print(out, g.output, "repo")
+}
+
+func repoRemoveCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("repo remove <name>...", &g)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("repo remove needs a repo name")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	result := newBatchResult("removed")
+	for _, name := range positional {
+		result.record(name, c.RemoveRepo(ctx, name))
+	}
+	return result.print(out, g.output, "repo")
+}
+
+func repoUpdateCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("repo update", &g)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("repo update takes no arguments")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	result := newBatchResult("updated")
+	result.record("all", c.UpdateRepos(ctx))
+	return result.print(out, g.output, "repos")
+}
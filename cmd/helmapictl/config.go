@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dush-t/helmapi/sdk"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// config is the file helmapictl reads the server and token from
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// globalFlags are accepted by every command
+type globalFlags struct {
+	server  string
+	token   string
+	config  string
+	output  string
+	timeout time.Duration
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.server, "server", "", "URL of the helmapi server (HELMAPI_SERVER)")
+	fs.StringVar(&g.token, "token", "", "Bearer token sent to the server (HELMAPI_TOKEN)")
+	fs.StringVar(&g.config, "config", "", "Config file (HELMAPICTL_CONFIG, default ~/.helmapictl.yaml)")
+	fs.StringVar(&g.output, "o", "table", "Output format: table or json")
+	fs.DurationVar(&g.timeout, "request-timeout", 0, "Give up on the server after this long, 0 for never")
+}
+
+func newFlagSet(name string, g *globalFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("helmapictl "+name, flag.ContinueOnError)
+	g.register(fs)
+	return fs
+}
+
+func configPath(flagValue string) string {
+	if len(flagValue) > 0 {
+		return flagValue
+	}
+	if path := os.Getenv("HELMAPICTL_CONFIG"); len(path) > 0 {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".helmapictl.yaml")
+}
+
+// loadConfig reads the config file. A missing file is only an error if it
+// was asked for explicitly.
+func loadConfig(flagValue string) (config, error) {
+	var c config
+	path := configPath(flagValue)
+	if len(path) == 0 {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && len(flagValue) == 0 {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("could not read config %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// firstSet returns the first non-empty value
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// client builds an SDK client from the flags, environment and config file,
+// in that order of precedence
+func (g *globalFlags) client() (*sdk.Client, error) {
+	if g.output != "table" && g.output != "json" {
+		return nil, fmt.Errorf("unknown output format %s, expected table or json", g.output)
+	}
+
+	c, err := loadConfig(g.config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := sdk.New(firstSet(g.server, os.Getenv("HELMAPI_SERVER"), c.Server, defaultServer))
+	client.Token = firstSet(g.token, os.Getenv("HELMAPI_TOKEN"), c.Token)
+	return client, nil
+}
+
+// context is cancelled after -request-timeout, if set
+func (g *globalFlags) context() (context.Context, context.CancelFunc) {
+	if g.timeout > 0 {
+		return context.WithTimeout(context.Background(), g.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
@@ -0,0 +1,135 @@
+// Command helmapictl is a command-line client for helmapi. It is built on
+// the sdk package, so it talks to the /v1 routes of the server.
+//
+// Usage:
+//
+//	helmapictl install <release> <chart> [-repo url] [-f values.yaml]...
+//	helmapictl delete <release>
+//	helmapictl repo add <name> <url>
+//	helmapictl repo remove <name>...
+//	helmapictl repo update
+//	helmapictl runtime restart <id>... [-strategy helm|rollout|delete-pods]
+//	helmapictl runtime delete <id>...
+//	helmapictl runtime list [-users a,b] [-label key=value]...
+//	helmapictl runtime get <id>
+//
+// Every command takes -server, -token, -config, -o table|json and
+// -request-timeout. Flags may come before or after arguments.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `helmapictl controls a helmapi server.
+
+Commands:
+  install <release> <chart>   Install a chart, or upgrade its release
+  delete <release>            Uninstall a release
+  repo add <name> <url>       Add a chart repo
+  repo remove <name>...       Remove chart repos
+  repo update                 Fetch the latest charts of every repo
+  runtime restart <id>...     Restart runtimes
+  runtime delete <id>...      Delete runtimes
+  runtime list                List runtimes
+  runtime get <id>            Show the state of a runtime
+
+Run helmapictl <command> -h for the flags of a command.
+
+The server and token come from -server and -token, then HELMAPI_SERVER and
+HELMAPI_TOKEN, then the config file (-config, HELMAPICTL_CONFIG or
+~/.helmapictl.yaml), which looks like:
+
+  server: http://helmapi:8080
+  token: ...
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "helmapictl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(args) == 0 {
+			return flag.ErrHelp
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "install":
+		return installCmd(args[1:], out)
+	case "delete":
+		return deleteCmd(args[1:], out)
+	case "repo":
+		return subcommand("repo", args[1:], out, map[string]func([]string, io.Writer) error{
+			"add":    repoAddCmd,
+			"remove": repoRemoveCmd,
+			"update": repoUpdateCmd,
+		})
+	case "runtime":
+		return subcommand("runtime", args[1:], out, map[string]func([]string, io.Writer) error{
+			"restart": runtimeRestartCmd,
+			"delete":  runtimeDeleteCmd,
+			"list":    runtimeListCmd,
+			"get":     runtimeGetCmd,
+		})
+	}
+
+	return fmt.Errorf("unknown command %s, see helmapictl -h", args[0])
+}
+
+func subcommand(name string, args []string, out io.Writer, commands map[string]func([]string, io.Writer) error) error {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("%s needs one of: %s", name, strings.Join(sortedStrings(names), ", "))
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %s %s, expected one of: %s", name, args[0], strings.Join(sortedStrings(names), ", "))
+	}
+	return cmd(args[1:], out)
+}
+
+// parseInterspersed parses flags that may come before, between or after
+// positional arguments, which flag.FlagSet.Parse alone does not allow
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
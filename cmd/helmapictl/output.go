@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func sortedStrings(values []string) []string {
+	sort.Strings(values)
+	return values
+}
+
+func printJSON(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// printTable writes rows under a header, with aligned columns
+func printTable(out io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// batchResult is the outcome of an action on several targets, printed like
+// the batch endpoints of the server respond: {<verb>: {id: ok}, errors: {id: error}}
+type batchResult struct {
+	verb   string
+	done   map[string]bool
+	errors map[string]string
+	order  []string
+}
+
+func newBatchResult(verb string) *batchResult {
+	return &batchResult{verb: verb, done: map[string]bool{}, errors: map[string]string{}}
+}
+
+func (b *batchResult) record(id string, err error) {
+	b.order = append(b.order, id)
+	b.done[id] = err == nil
+	if err != nil {
+		b.errors[id] = err.Error()
+	}
+}
+
+// print writes the result and returns an error if any target failed
+func (b *batchResult) print(out io.Writer, format string, kind string) error {
+	if format == "json" {
+		payload := map[string]interface{}{b.verb: b.done}
+		if len(b.errors) > 0 {
+			payload["errors"] = b.errors
+		}
+		if err := printJSON(out, payload); err != nil {
+			return err
+		}
+	} else {
+		for _, id := range b.order {
+			if b.done[id] {
+				fmt.Fprintf(out, "%s/%s %s\n", kind, id, b.verb)
+			} else {
+				fmt.Fprintf(out, "%s/%s failed: %s\n", kind, id, b.errors[id])
+			}
+		}
+	}
+
+	if len(b.errors) > 0 {
+		return fmt.Errorf("%d of %d failed", len(b.errors), len(b.order))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/sdk"
+)
+
+func runtimeRestartCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("runtime restart <id>...", &g)
+	strategy := fs.String("strategy", "", "How pods are replaced: helm (default), rollout or delete-pods")
+	timeout := fs.String("timeout", "", "How long to wait for each runtime, e.g. 5m")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("runtime restart needs a runtime ID")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	opts := sdk.RestartOptions{Strategy: client.RestartStrategy(*strategy), Timeout: *timeout}
+	result := newBatchResult("restarted")
+	for _, id := range positional {
+		result.record(id, c.RestartRuntime(ctx, id, opts))
+	}
+	return result.print(out, g.output, "runtime")
+}
+
+func runtimeDeleteCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("runtime delete <id>...", &g)
+	timeout := fs.String("timeout", "", "helm --timeout, e.g. 5m")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("runtime delete needs a runtime ID")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	result := newBatchResult("deleted")
+	for _, id := range positional {
+		result.record(id, c.DeleteRuntime(ctx, id, *timeout))
+	}
+	return result.print(out, g.output, "runtime")
+}
+
+func runtimeListCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	var labels stringList
+	fs := newFlagSet("runtime list", &g)
+	users := fs.String("users", "", "Comma separated users")
+	namespace := fs.String("namespace", "", "Namespace, all if empty")
+	live := fs.Bool("live", false, "Ask the API server instead of the cache of helmapi")
+	fs.Var(&labels, "label", "key=value the pods must have, can be repeated")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("runtime list takes no arguments")
+	}
+
+	filter := sdk.RuntimeFilter{Namespace: *namespace, Live: *live, Labels: map[string]string{}}
+	if len(*users) > 0 {
+		filter.Users = strings.Split(*users, ",")
+	}
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid label %s, expected key=value", label)
+		}
+		filter.Labels[parts[0]] = parts[1]
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	list, err := c.ListRuntimes(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if g.output == "json" {
+		return printJSON(out, list)
+	}
+
+	rows := make([][]string, 0, len(list.Runtimes))
+	for _, rt := range list.Runtimes {
+		rows = append(rows, []string{rt.RuntimeId, rt.OwnerId, rt.Namespace, fmt.Sprintf("%d/%d", rt.ReadyPods, rt.Pods)})
+	}
+	return printTable(out, []string{"RUNTIME", "OWNER", "NAMESPACE", "READY"}, rows)
+}
+
+func runtimeGetCmd(args []string, out io.Writer) error {
+	var g globalFlags
+	fs := newFlagSet("runtime get <id>", &g)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("runtime get needs one runtime ID")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := g.context()
+	defer cancel()
+
+	status, err := c.GetRuntime(ctx, positional[0])
+	if sdk.IsNotFound(err) {
+		return fmt.Errorf("runtime %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	if g.output == "json" {
+		return printJSON(out, status)
+	}
+
+	err = printTable(out, []string{"RUNTIME", "STATE", "RELEASE", "REVISION", "CHART", "UPDATED"}, [][]string{{
+		positional[0], status.State, status.ReleaseStatus, status.Revision, status.ChartVersion, status.Updated,
+	}})
+	if err != nil || len(status.Pods) == 0 {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	rows := make([][]string, 0, len(status.Pods))
+	for _, pod := range status.Pods {
+		rows = append(rows, []string{
+			pod.Name,
+			pod.Status,
+			strconv.FormatBool(pod.Ready),
+			strconv.Itoa(int(pod.RestartCount)),
+			pod.Node,
+			time.Since(pod.CreatedAt.Time).Round(time.Second).String(),
+		})
+	}
+	return printTable(out, []string{"POD", "STATUS", "READY", "RESTARTS", "NODE", "AGE"}, rows)
+}
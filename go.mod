@@ -3,7 +3,13 @@ module github.com/dush-t/helmapi
 go 1.15
 
 require (
+	github.com/evanphx/json-patch v4.12.0+incompatible
+	golang.org/x/net v0.0.0-20211209124913-491a49abca63
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.27.1
 	k8s.io/api v0.23.4
 	k8s.io/apimachinery v0.23.4
 	k8s.io/client-go v0.23.4
+	k8s.io/metrics v0.23.4
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -3,30 +3,91 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/dush-t/helmapi/api"
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/client/k8s"
+	"github.com/dush-t/helmapi/rpc"
 )
 
 func main() {
 
-	// Routes for charts
-	http.Handle("/install", api.InstallChartHandler())
-	http.Handle("/delete", api.DeleteReleaseHandler())
+	// Versioned REST API. The routes below are kept for compatibility.
+	http.Handle("/v1/", api.V1Handler())
+
+	// Spec of the API, and a page documenting it
+	http.Handle("/openapi.json", api.OpenAPIHandler())
+	http.Handle("/docs", api.DocsHandler())
+
+	// Routes for charts. Requests are checked against the spec by
+	// api.Validated, and mutating routes are wrapped in api.Idempotent to
+	// honour the Idempotency-Key header.
+	http.Handle("/install", api.Validated("/install", api.Idempotent(api.InstallChartHandler())))
+	http.Handle("/delete", api.Validated("/delete", api.Idempotent(api.DeleteReleaseHandler())))
 
 	// Routes for repos
-	http.Handle("/repo/add", api.AddRepoHandler())
-	http.Handle("/repo/delete", api.RemoveRepoHandler())
-	http.Handle("/repo/update", api.RepoUpdateHandler())
+	http.Handle("/repo/add", api.Validated("/repo/add", api.Idempotent(api.AddRepoHandler())))
+	http.Handle("/repo/delete", api.Validated("/repo/delete", api.Idempotent(api.RemoveRepoHandler())))
+	http.Handle("/repo/update", api.Validated("/repo/update", api.Idempotent(api.RepoUpdateHandler())))
 
 	// Endpoints for runtime management
-	http.Handle("/runtime/restart", api.RestartRuntimeHandler())
-	http.Handle("/runtime/delete", api.DeleteRuntimeHandler())
-	http.Handle("/runtime/list-pods", api.FetchRuntimePodsHandler())
-	http.Handle("/runtime/get-pod", api.FetchRuntimePodByNameHandler())
+	http.Handle("/runtime/create", api.Validated("/runtime/create", api.Idempotent(api.CreateRuntimeHandler())))
+	http.Handle("/runtime/restart", api.Validated("/runtime/restart", api.Idempotent(api.RestartRuntimeHandler())))
+	http.Handle("/runtime/delete", api.Validated("/runtime/delete", api.Idempotent(api.DeleteRuntimeHandler())))
+	http.Handle("/runtime/upgrade", api.Validated("/runtime/upgrade", api.Idempotent(api.UpgradeRuntimeHandler())))
+	http.Handle("/runtime/suspend", api.Validated("/runtime/suspend", api.Idempotent(api.SuspendRuntimeHandler())))
+	http.Handle("/runtime/resume", api.Validated("/runtime/resume", api.Idempotent(api.ResumeRuntimeHandler())))
+	http.Handle("/runtime/rollout-status", api.Validated("/runtime/rollout-status", api.RolloutStatusHandler()))
+	http.Handle("/runtime/status", api.Validated("/runtime/status", api.RuntimeStatusHandler()))
+	http.Handle("/runtime/list-pods", api.Validated("/runtime/list-pods", api.FetchRuntimePodsHandler()))
+	http.Handle("/runtime/get-pod", api.Validated("/runtime/get-pod", api.FetchRuntimePodByNameHandler()))
+	http.Handle("/runtime/metrics", api.Validated("/runtime/metrics", api.FetchRuntimeMetricsHandler()))
+	http.Handle("/runtime/events", api.Validated("/runtime/events", api.FetchRuntimeEventsHandler()))
+	http.Handle("/runtime/logs", api.Validated("/runtime/logs", api.FetchRuntimeLogsHandler()))
+	http.Handle("/runtime/watch", api.Validated("/runtime/watch", api.WatchRuntimePodsHandler()))
+
+	// Support endpoints, authenticated with SUPPORT_TOKENS
+	http.Handle("/runtime/exec", api.Validated("/runtime/exec", api.ExecRuntimeHandler()))
+	http.Handle("/runtime/port-forward", api.Validated("/runtime/port-forward", api.PortForwardRuntimeHandler()))
+
+	// Quota limits and usage of a user
+	http.Handle("/quota/", api.Validated("/quota/{user}", api.QuotaHandler()))
+
+	// Endpoints for the runtime reaper
+	http.Handle("/reaper/plan", api.Validated("/reaper/plan", api.ReaperPlanHandler()))
+	http.Handle("/reaper/override", api.Validated("/reaper/override", api.Idempotent(api.ReaperOverrideHandler())))
 
 	// Health check endpoint
 	http.Handle("/healthcheck", api.HealthCheckHandler())
 
+	// Runtime pod queries are served from an informer cache once it has synced
+	if err := k8s.StartRuntimePodCache(); err != nil {
+		log.Println(err)
+	}
+
+	// Pick up rollouts left behind by replicas that went away
+	go client.WatchOrphanedRollouts(30 * time.Second)
+
+	// Suspend or delete idle runtimes as told by REAPER_POLICY
+	go client.RunReaper()
+
+	// Forget the responses of idempotency keys once their window is over
+	go api.ExpireIdempotencyKeys(10 * time.Minute)
+
+	// gRPC API on its own port, GRPC_ADDR or :9090
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if len(grpcAddr) == 0 {
+		grpcAddr = ":9090"
+	}
+	go func() {
+		log.Println("gRPC server started on", grpcAddr)
+		if err := rpc.Serve(grpcAddr); err != nil {
+			log.Fatal("Error starting gRPC server:", err)
+		}
+	}()
+
 	log.Println("HTTP server started on :8080")
 	err := http.ListenAndServe(":8080", nil)
 	if err != nil {
@@ -0,0 +1,790 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: helmapipb/helmapi.proto
+
+package helmapipb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// HelmAPIClient is the client API for HelmAPI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type HelmAPIClient interface {
+	// InstallChart installs a chart, or upgrades its release if it exists
+	InstallChart(ctx context.Context, in *InstallChartRequest, opts ...grpc.CallOption) (*InstallChartResponse, error)
+	// DeleteRelease uninstalls a release
+	DeleteRelease(ctx context.Context, in *DeleteReleaseRequest, opts ...grpc.CallOption) (*DeleteReleaseResponse, error)
+	AddRepo(ctx context.Context, in *AddRepoRequest, opts ...grpc.CallOption) (*AddRepoResponse, error)
+	RemoveRepos(ctx context.Context, in *RemoveReposRequest, opts ...grpc.CallOption) (*RemoveReposResponse, error)
+	// UpdateRepos fetches the latest charts of every repo
+	UpdateRepos(ctx context.Context, in *UpdateReposRequest, opts ...grpc.CallOption) (*UpdateReposResponse, error)
+	CreateRuntimes(ctx context.Context, in *CreateRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_CreateRuntimesClient, error)
+	RestartRuntimes(ctx context.Context, in *RestartRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_RestartRuntimesClient, error)
+	DeleteRuntimes(ctx context.Context, in *DeleteRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_DeleteRuntimesClient, error)
+	SuspendRuntimes(ctx context.Context, in *SuspendRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_SuspendRuntimesClient, error)
+	ResumeRuntimes(ctx context.Context, in *ResumeRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_ResumeRuntimesClient, error)
+	// GetRuntimeStatuses sends the release and pod state of each runtime
+	GetRuntimeStatuses(ctx context.Context, in *GetRuntimeStatusesRequest, opts ...grpc.CallOption) (HelmAPI_GetRuntimeStatusesClient, error)
+	// GetRuntime returns the release and pod state of a runtime, or NOT_FOUND
+	GetRuntime(ctx context.Context, in *GetRuntimeRequest, opts ...grpc.CallOption) (*RuntimeStatus, error)
+	// UpgradeRuntime moves a runtime to a new chart version and/or patches
+	// its values
+	UpgradeRuntime(ctx context.Context, in *UpgradeRuntimeRequest, opts ...grpc.CallOption) (*UpgradeRuntimeResponse, error)
+	// RollbackRuntime rolls the release of a runtime back to a revision
+	RollbackRuntime(ctx context.Context, in *RollbackRuntimeRequest, opts ...grpc.CallOption) (*RollbackRuntimeResponse, error)
+	// ListRuntimes lists runtimes as seen from their pods
+	ListRuntimes(ctx context.Context, in *ListRuntimesRequest, opts ...grpc.CallOption) (*ListRuntimesResponse, error)
+}
+
+type helmAPIClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHelmAPIClient(cc grpc.ClientConnInterface) HelmAPIClient {
+	return &helmAPIClient{cc}
+}
+
+func (c *helmAPIClient) InstallChart(ctx context.Context, in *InstallChartRequest, opts ...grpc.CallOption) (*InstallChartResponse, error) {
+	out := new(InstallChartResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/InstallChart", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) DeleteRelease(ctx context.Context, in *DeleteReleaseRequest, opts ...grpc.CallOption) (*DeleteReleaseResponse, error) {
+	out := new(DeleteReleaseResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/DeleteRelease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) AddRepo(ctx context.Context, in *AddRepoRequest, opts ...grpc.CallOption) (*AddRepoResponse, error) {
+	out := new(AddRepoResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/AddRepo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) RemoveRepos(ctx context.Context, in *RemoveReposRequest, opts ...grpc.CallOption) (*RemoveReposResponse, error) {
+	out := new(RemoveReposResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/RemoveRepos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) UpdateRepos(ctx context.Context, in *UpdateReposRequest, opts ...grpc.CallOption) (*UpdateReposResponse, error) {
+	out := new(UpdateReposResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/UpdateRepos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) CreateRuntimes(ctx context.Context, in *CreateRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_CreateRuntimesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[0], "/helmapi.v1.HelmAPI/CreateRuntimes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPICreateRuntimesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_CreateRuntimesClient interface {
+	Recv() (*RuntimeResult, error)
+	grpc.ClientStream
+}
+
+type helmAPICreateRuntimesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPICreateRuntimesClient) Recv() (*RuntimeResult, error) {
+	m := new(RuntimeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) RestartRuntimes(ctx context.Context, in *RestartRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_RestartRuntimesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[1], "/helmapi.v1.HelmAPI/RestartRuntimes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPIRestartRuntimesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_RestartRuntimesClient interface {
+	Recv() (*RuntimeResult, error)
+	grpc.ClientStream
+}
+
+type helmAPIRestartRuntimesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPIRestartRuntimesClient) Recv() (*RuntimeResult, error) {
+	m := new(RuntimeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) DeleteRuntimes(ctx context.Context, in *DeleteRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_DeleteRuntimesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[2], "/helmapi.v1.HelmAPI/DeleteRuntimes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPIDeleteRuntimesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_DeleteRuntimesClient interface {
+	Recv() (*RuntimeResult, error)
+	grpc.ClientStream
+}
+
+type helmAPIDeleteRuntimesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPIDeleteRuntimesClient) Recv() (*RuntimeResult, error) {
+	m := new(RuntimeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) SuspendRuntimes(ctx context.Context, in *SuspendRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_SuspendRuntimesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[3], "/helmapi.v1.HelmAPI/SuspendRuntimes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPISuspendRuntimesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_SuspendRuntimesClient interface {
+	Recv() (*RuntimeResult, error)
+	grpc.ClientStream
+}
+
+type helmAPISuspendRuntimesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPISuspendRuntimesClient) Recv() (*RuntimeResult, error) {
+	m := new(RuntimeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) ResumeRuntimes(ctx context.Context, in *ResumeRuntimesRequest, opts ...grpc.CallOption) (HelmAPI_ResumeRuntimesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[4], "/helmapi.v1.HelmAPI/ResumeRuntimes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPIResumeRuntimesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_ResumeRuntimesClient interface {
+	Recv() (*RuntimeResult, error)
+	grpc.ClientStream
+}
+
+type helmAPIResumeRuntimesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPIResumeRuntimesClient) Recv() (*RuntimeResult, error) {
+	m := new(RuntimeResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) GetRuntimeStatuses(ctx context.Context, in *GetRuntimeStatusesRequest, opts ...grpc.CallOption) (HelmAPI_GetRuntimeStatusesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &HelmAPI_ServiceDesc.Streams[5], "/helmapi.v1.HelmAPI/GetRuntimeStatuses", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &helmAPIGetRuntimeStatusesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type HelmAPI_GetRuntimeStatusesClient interface {
+	Recv() (*RuntimeStatusResult, error)
+	grpc.ClientStream
+}
+
+type helmAPIGetRuntimeStatusesClient struct {
+	grpc.ClientStream
+}
+
+func (x *helmAPIGetRuntimeStatusesClient) Recv() (*RuntimeStatusResult, error) {
+	m := new(RuntimeStatusResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *helmAPIClient) GetRuntime(ctx context.Context, in *GetRuntimeRequest, opts ...grpc.CallOption) (*RuntimeStatus, error) {
+	out := new(RuntimeStatus)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/GetRuntime", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) UpgradeRuntime(ctx context.Context, in *UpgradeRuntimeRequest, opts ...grpc.CallOption) (*UpgradeRuntimeResponse, error) {
+	out := new(UpgradeRuntimeResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/UpgradeRuntime", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) RollbackRuntime(ctx context.Context, in *RollbackRuntimeRequest, opts ...grpc.CallOption) (*RollbackRuntimeResponse, error) {
+	out := new(RollbackRuntimeResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/RollbackRuntime", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *helmAPIClient) ListRuntimes(ctx context.Context, in *ListRuntimesRequest, opts ...grpc.CallOption) (*ListRuntimesResponse, error) {
+	out := new(ListRuntimesResponse)
+	err := c.cc.Invoke(ctx, "/helmapi.v1.HelmAPI/ListRuntimes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HelmAPIServer is the server API for HelmAPI service.
+// All implementations must embed UnimplementedHelmAPIServer
+// for forward compatibility
+type HelmAPIServer interface {
+	// InstallChart installs a chart, or upgrades its release if it exists
+	InstallChart(context.Context, *InstallChartRequest) (*InstallChartResponse, error)
+	// DeleteRelease uninstalls a release
+	DeleteRelease(context.Context, *DeleteReleaseRequest) (*DeleteReleaseResponse, error)
+	AddRepo(context.Context, *AddRepoRequest) (*AddRepoResponse, error)
+	RemoveRepos(context.Context, *RemoveReposRequest) (*RemoveReposResponse, error)
+	// UpdateRepos fetches the latest charts of every repo
+	UpdateRepos(context.Context, *UpdateReposRequest) (*UpdateReposResponse, error)
+	CreateRuntimes(*CreateRuntimesRequest, HelmAPI_CreateRuntimesServer) error
+	RestartRuntimes(*RestartRuntimesRequest, HelmAPI_RestartRuntimesServer) error
+	DeleteRuntimes(*DeleteRuntimesRequest, HelmAPI_DeleteRuntimesServer) error
+	SuspendRuntimes(*SuspendRuntimesRequest, HelmAPI_SuspendRuntimesServer) error
+	ResumeRuntimes(*ResumeRuntimesRequest, HelmAPI_ResumeRuntimesServer) error
+	// GetRuntimeStatuses sends the release and pod state of each runtime
+	GetRuntimeStatuses(*GetRuntimeStatusesRequest, HelmAPI_GetRuntimeStatusesServer) error
+	// GetRuntime returns the release and pod state of a runtime, or NOT_FOUND
+	GetRuntime(context.Context, *GetRuntimeRequest) (*RuntimeStatus, error)
+	// UpgradeRuntime moves a runtime to a new chart version and/or patches
+	// its values
+	UpgradeRuntime(context.Context, *UpgradeRuntimeRequest) (*UpgradeRuntimeResponse, error)
+	// RollbackRuntime rolls the release of a runtime back to a revision
+	RollbackRuntime(context.Context, *RollbackRuntimeRequest) (*RollbackRuntimeResponse, error)
+	// ListRuntimes lists runtimes as seen from their pods
+	ListRuntimes(context.Context, *ListRuntimesRequest) (*ListRuntimesResponse, error)
+	mustEmbedUnimplementedHelmAPIServer()
+}
+
+// UnimplementedHelmAPIServer must be embedded to have forward compatible implementations.
+type UnimplementedHelmAPIServer struct {
+}
+
+func (UnimplementedHelmAPIServer) InstallChart(context.Context, *InstallChartRequest) (*InstallChartResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InstallChart not implemented")
+}
+func (UnimplementedHelmAPIServer) DeleteRelease(context.Context, *DeleteReleaseRequest) (*DeleteReleaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRelease not implemented")
+}
+func (UnimplementedHelmAPIServer) AddRepo(context.Context, *AddRepoRequest) (*AddRepoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddRepo not implemented")
+}
+func (UnimplementedHelmAPIServer) RemoveRepos(context.Context, *RemoveReposRequest) (*RemoveReposResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveRepos not implemented")
+}
+func (UnimplementedHelmAPIServer) UpdateRepos(context.Context, *UpdateReposRequest) (*UpdateReposResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRepos not implemented")
+}
+func (UnimplementedHelmAPIServer) CreateRuntimes(*CreateRuntimesRequest, HelmAPI_CreateRuntimesServer) error {
+	return status.Errorf(codes.Unimplemented, "method CreateRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) RestartRuntimes(*RestartRuntimesRequest, HelmAPI_RestartRuntimesServer) error {
+	return status.Errorf(codes.Unimplemented, "method RestartRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) DeleteRuntimes(*DeleteRuntimesRequest, HelmAPI_DeleteRuntimesServer) error {
+	return status.Errorf(codes.Unimplemented, "method DeleteRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) SuspendRuntimes(*SuspendRuntimesRequest, HelmAPI_SuspendRuntimesServer) error {
+	return status.Errorf(codes.Unimplemented, "method SuspendRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) ResumeRuntimes(*ResumeRuntimesRequest, HelmAPI_ResumeRuntimesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ResumeRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) GetRuntimeStatuses(*GetRuntimeStatusesRequest, HelmAPI_GetRuntimeStatusesServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetRuntimeStatuses not implemented")
+}
+func (UnimplementedHelmAPIServer) GetRuntime(context.Context, *GetRuntimeRequest) (*RuntimeStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRuntime not implemented")
+}
+func (UnimplementedHelmAPIServer) UpgradeRuntime(context.Context, *UpgradeRuntimeRequest) (*UpgradeRuntimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpgradeRuntime not implemented")
+}
+func (UnimplementedHelmAPIServer) RollbackRuntime(context.Context, *RollbackRuntimeRequest) (*RollbackRuntimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackRuntime not implemented")
+}
+func (UnimplementedHelmAPIServer) ListRuntimes(context.Context, *ListRuntimesRequest) (*ListRuntimesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRuntimes not implemented")
+}
+func (UnimplementedHelmAPIServer) mustEmbedUnimplementedHelmAPIServer() {}
+
+// UnsafeHelmAPIServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HelmAPIServer will
+// result in compilation errors.
+type UnsafeHelmAPIServer interface {
+	mustEmbedUnimplementedHelmAPIServer()
+}
+
+func RegisterHelmAPIServer(s grpc.ServiceRegistrar, srv HelmAPIServer) {
+	s.RegisterService(&HelmAPI_ServiceDesc, srv)
+}
+
+func _HelmAPI_InstallChart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstallChartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).InstallChart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/InstallChart",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).InstallChart(ctx, req.(*InstallChartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_DeleteRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).DeleteRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/DeleteRelease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).DeleteRelease(ctx, req.(*DeleteReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_AddRepo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRepoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).AddRepo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/AddRepo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).AddRepo(ctx, req.(*AddRepoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_RemoveRepos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveReposRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).RemoveRepos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/RemoveRepos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).RemoveRepos(ctx, req.(*RemoveReposRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_UpdateRepos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateReposRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).UpdateRepos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/UpdateRepos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).UpdateRepos(ctx, req.(*UpdateReposRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_CreateRuntimes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CreateRuntimesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).CreateRuntimes(m, &helmAPICreateRuntimesServer{stream})
+}
+
+type HelmAPI_CreateRuntimesServer interface {
+	Send(*RuntimeResult) error
+	grpc.ServerStream
+}
+
+type helmAPICreateRuntimesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPICreateRuntimesServer) Send(m *RuntimeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_RestartRuntimes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RestartRuntimesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).RestartRuntimes(m, &helmAPIRestartRuntimesServer{stream})
+}
+
+type HelmAPI_RestartRuntimesServer interface {
+	Send(*RuntimeResult) error
+	grpc.ServerStream
+}
+
+type helmAPIRestartRuntimesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPIRestartRuntimesServer) Send(m *RuntimeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_DeleteRuntimes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DeleteRuntimesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).DeleteRuntimes(m, &helmAPIDeleteRuntimesServer{stream})
+}
+
+type HelmAPI_DeleteRuntimesServer interface {
+	Send(*RuntimeResult) error
+	grpc.ServerStream
+}
+
+type helmAPIDeleteRuntimesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPIDeleteRuntimesServer) Send(m *RuntimeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_SuspendRuntimes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SuspendRuntimesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).SuspendRuntimes(m, &helmAPISuspendRuntimesServer{stream})
+}
+
+type HelmAPI_SuspendRuntimesServer interface {
+	Send(*RuntimeResult) error
+	grpc.ServerStream
+}
+
+type helmAPISuspendRuntimesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPISuspendRuntimesServer) Send(m *RuntimeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_ResumeRuntimes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ResumeRuntimesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).ResumeRuntimes(m, &helmAPIResumeRuntimesServer{stream})
+}
+
+type HelmAPI_ResumeRuntimesServer interface {
+	Send(*RuntimeResult) error
+	grpc.ServerStream
+}
+
+type helmAPIResumeRuntimesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPIResumeRuntimesServer) Send(m *RuntimeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_GetRuntimeStatuses_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRuntimeStatusesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(HelmAPIServer).GetRuntimeStatuses(m, &helmAPIGetRuntimeStatusesServer{stream})
+}
+
+type HelmAPI_GetRuntimeStatusesServer interface {
+	Send(*RuntimeStatusResult) error
+	grpc.ServerStream
+}
+
+type helmAPIGetRuntimeStatusesServer struct {
+	grpc.ServerStream
+}
+
+func (x *helmAPIGetRuntimeStatusesServer) Send(m *RuntimeStatusResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _HelmAPI_GetRuntime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRuntimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).GetRuntime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/GetRuntime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).GetRuntime(ctx, req.(*GetRuntimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_UpgradeRuntime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpgradeRuntimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).UpgradeRuntime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/UpgradeRuntime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).UpgradeRuntime(ctx, req.(*UpgradeRuntimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_RollbackRuntime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackRuntimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).RollbackRuntime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/RollbackRuntime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).RollbackRuntime(ctx, req.(*RollbackRuntimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HelmAPI_ListRuntimes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRuntimesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelmAPIServer).ListRuntimes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/helmapi.v1.HelmAPI/ListRuntimes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelmAPIServer).ListRuntimes(ctx, req.(*ListRuntimesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// HelmAPI_ServiceDesc is the grpc.ServiceDesc for HelmAPI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var HelmAPI_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helmapi.v1.HelmAPI",
+	HandlerType: (*HelmAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "InstallChart",
+			Handler:    _HelmAPI_InstallChart_Handler,
+		},
+		{
+			MethodName: "DeleteRelease",
+			Handler:    _HelmAPI_DeleteRelease_Handler,
+		},
+		{
+			MethodName: "AddRepo",
+			Handler:    _HelmAPI_AddRepo_Handler,
+		},
+		{
+			MethodName: "RemoveRepos",
+			Handler:    _HelmAPI_RemoveRepos_Handler,
+		},
+		{
+			MethodName: "UpdateRepos",
+			Handler:    _HelmAPI_UpdateRepos_Handler,
+		},
+		{
+			MethodName: "GetRuntime",
+			Handler:    _HelmAPI_GetRuntime_Handler,
+		},
+		{
+			MethodName: "UpgradeRuntime",
+			Handler:    _HelmAPI_UpgradeRuntime_Handler,
+		},
+		{
+			MethodName: "RollbackRuntime",
+			Handler:    _HelmAPI_RollbackRuntime_Handler,
+		},
+		{
+			MethodName: "ListRuntimes",
+			Handler:    _HelmAPI_ListRuntimes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateRuntimes",
+			Handler:       _HelmAPI_CreateRuntimes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "RestartRuntimes",
+			Handler:       _HelmAPI_RestartRuntimes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "DeleteRuntimes",
+			Handler:       _HelmAPI_DeleteRuntimes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SuspendRuntimes",
+			Handler:       _HelmAPI_SuspendRuntimes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ResumeRuntimes",
+			Handler:       _HelmAPI_ResumeRuntimes_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetRuntimeStatuses",
+			Handler:       _HelmAPI_GetRuntimeStatuses_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "helmapipb/helmapi.proto",
+}
@@ -0,0 +1,377 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/client/k8s"
+	"github.com/dush-t/helmapi/rpc/helmapipb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// streamForEach calls fn for every runtime ID, either one after the other
+// or all at once, and sends the result of each as soon as it is known. Like
+// the HTTP API, operations that started keep going if the caller leaves.
+func streamForEach(runtimeIds []string, concurrent bool, send func(*helmapipb.RuntimeResult) error, fn func(runtimeId string) *helmapipb.RuntimeResult) error {
+	if !concurrent {
+		for _, runtimeId := range runtimeIds {
+			if err := send(fn(runtimeId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results := make(chan *helmapipb.RuntimeResult, len(runtimeIds))
+	var wg sync.WaitGroup
+	for _, rId := range runtimeIds {
+		runtimeId := rId
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- fn(runtimeId)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		if err := send(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runtimeResult(runtimeId string, err error) *helmapipb.RuntimeResult {
+	result := &helmapipb.RuntimeResult{RuntimeId: runtimeId, Ok: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// validateRuntimeIds checks a batch before any of it is run. A runtime may
+// only be in it once, as its operations would otherwise race.
+func validateRuntimeIds(runtimeIds []string) error {
+	if len(runtimeIds) == 0 {
+		return status.Error(codes.InvalidArgument, "runtime_ids is required")
+	}
+	seen := make(map[string]bool, len(runtimeIds))
+	for _, runtimeId := range runtimeIds {
+		if err := validateRuntimeId(runtimeId); err != nil {
+			return err
+		}
+		if seen[runtimeId] {
+			return status.Errorf(codes.InvalidArgument, "runtime_id %s is in the batch more than once", runtimeId)
+		}
+		seen[runtimeId] = true
+	}
+	return nil
+}
+
+// CreateRuntimes installs runtimes, streaming the result of each
+func (s *Server) CreateRuntimes(req *helmapipb.CreateRuntimesRequest, stream helmapipb.HelmAPI_CreateRuntimesServer) error {
+	if len(req.Runtimes) == 0 {
+		return status.Error(codes.InvalidArgument, "runtimes is required")
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return err
+	}
+
+	specs := make(map[string]client.RuntimeSpec, len(req.Runtimes))
+	runtimeIds := make([]string, len(req.Runtimes))
+	for i, spec := range req.Runtimes {
+		rs := client.RuntimeSpec{
+			RuntimeId:         spec.RuntimeId,
+			Owner:             spec.Owner,
+			PrivateChartsRepo: spec.PrivateChartsRepo,
+			Values:            spec.Values.AsMap(),
+		}
+		if err := rs.Validate(); err != nil {
+			return toStatus(err)
+		}
+		specs[spec.RuntimeId] = rs
+		runtimeIds[i] = spec.RuntimeId
+	}
+	if err := validateRuntimeIds(runtimeIds); err != nil {
+		return err
+	}
+
+	return streamForEach(runtimeIds, req.Concurrent, stream.Send, func(runtimeId string) *helmapipb.RuntimeResult {
+		return runtimeResult(runtimeId, client.CreateRuntime(specs[runtimeId], req.Timeout))
+	})
+}
+
+// RestartRuntimes restarts runtimes, streaming the result of each as it
+// comes back. Failures carry the recent warning events of the runtime.
+func (s *Server) RestartRuntimes(req *helmapipb.RestartRuntimesRequest, stream helmapipb.HelmAPI_RestartRuntimesServer) error {
+	if err := validateRuntimeIds(req.RuntimeIds); err != nil {
+		return err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return err
+	}
+	strategy := client.RestartStrategy(req.Strategy)
+	switch strategy {
+	case "", client.RestartHelm, client.RestartRollout, client.RestartDeletePods:
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown restart strategy %s", req.Strategy)
+	}
+
+	ctx := stream.Context()
+	return streamForEach(req.RuntimeIds, req.Concurrent, stream.Send, func(runtimeId string) *helmapipb.RuntimeResult {
+		result := runtimeResult(runtimeId, client.RestartRuntimeWithStrategy(runtimeId, strategy, req.Timeout))
+		if result.Ok {
+			return result
+		}
+
+		// The reason a restart failed is usually in the events of the
+		// runtime, e.g. a failed image pull
+		events, err := k8s.GetRuntimeEvents(ctx, "", runtimeId, true, 5)
+		if err != nil {
+			log.Println(err)
+			return result
+		}
+		for _, event := range events {
+			result.Warnings = append(result.Warnings, &helmapipb.Event{
+				Type:       event.Type,
+				Reason:     event.Reason,
+				Message:    event.Message,
+				Count:      event.Count,
+				ObjectKind: event.ObjectKind,
+				ObjectName: event.ObjectName,
+				LastSeen:   timestamppb.New(event.LastSeen.Time),
+			})
+		}
+		return result
+	})
+}
+
+// DeleteRuntimes uninstalls runtimes, streaming the result of each
+func (s *Server) DeleteRuntimes(req *helmapipb.DeleteRuntimesRequest, stream helmapipb.HelmAPI_DeleteRuntimesServer) error {
+	if err := validateRuntimeIds(req.RuntimeIds); err != nil {
+		return err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return err
+	}
+
+	return streamForEach(req.RuntimeIds, req.Concurrent, stream.Send, func(runtimeId string) *helmapipb.RuntimeResult {
+		dr, err := client.GetDeleteRequestFromRuntimeId(runtimeId)
+		if err == nil {
+			err = dr.Execute(req.Timeout)
+		}
+		return runtimeResult(runtimeId, err)
+	})
+}
+
+// SuspendRuntimes scales runtimes to zero, streaming the result of each
+func (s *Server) SuspendRuntimes(req *helmapipb.SuspendRuntimesRequest, stream helmapipb.HelmAPI_SuspendRuntimesServer) error {
+	if err := validateRuntimeIds(req.RuntimeIds); err != nil {
+		return err
+	}
+
+	return streamForEach(req.RuntimeIds, req.Concurrent, stream.Send, func(runtimeId string) *helmapipb.RuntimeResult {
+		return runtimeResult(runtimeId, client.SuspendRuntime(runtimeId))
+	})
+}
+
+// ResumeRuntimes brings suspended runtimes back, streaming the result of
+// each once its pods are ready
+func (s *Server) ResumeRuntimes(req *helmapipb.ResumeRuntimesRequest, stream helmapipb.HelmAPI_ResumeRuntimesServer) error {
+	if err := validateRuntimeIds(req.RuntimeIds); err != nil {
+		return err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return err
+	}
+
+	return streamForEach(req.RuntimeIds, req.Concurrent, stream.Send, func(runtimeId string) *helmapipb.RuntimeResult {
+		return runtimeResult(runtimeId, client.ResumeRuntime(runtimeId, req.Timeout))
+	})
+}
+
+// GetRuntimeStatuses sends the release and pod state of each runtime as it
+// is looked up. Unlike GetRuntime, a missing runtime is sent with its Missing
+// state.
+func (s *Server) GetRuntimeStatuses(req *helmapipb.GetRuntimeStatusesRequest, stream helmapipb.HelmAPI_GetRuntimeStatusesServer) error {
+	if err := validateRuntimeIds(req.RuntimeIds); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	var mu sync.Mutex
+	statuses := make(map[string]*helmapipb.RuntimeStatus, len(req.RuntimeIds))
+	send := func(result *helmapipb.RuntimeResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return stream.Send(&helmapipb.RuntimeStatusResult{
+			RuntimeId: result.RuntimeId,
+			Status:    statuses[result.RuntimeId],
+			Error:     result.Error,
+		})
+	}
+
+	return streamForEach(req.RuntimeIds, req.Concurrent, send, func(runtimeId string) *helmapipb.RuntimeResult {
+		rs, err := client.GetRuntimeStatus(ctx, runtimeId)
+		if err == nil {
+			mu.Lock()
+			statuses[runtimeId] = runtimeStatus(rs)
+			mu.Unlock()
+		}
+		return runtimeResult(runtimeId, err)
+	})
+}
+
+// GetRuntime returns the release and pod state of a runtime
+func (s *Server) GetRuntime(ctx context.Context, req *helmapipb.GetRuntimeRequest) (*helmapipb.RuntimeStatus, error) {
+	if err := validateRuntimeId(req.RuntimeId); err != nil {
+		return nil, err
+	}
+
+	rs, err := client.GetRuntimeStatus(ctx, req.RuntimeId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if rs.State == client.RuntimeStateMissing {
+		return nil, status.Errorf(codes.NotFound, "runtime %s not found", req.RuntimeId)
+	}
+	return runtimeStatus(rs), nil
+}
+
+func runtimeStatus(rs client.RuntimeStatus) *helmapipb.RuntimeStatus {
+	result := &helmapipb.RuntimeStatus{
+		State:         rs.State,
+		ReleaseStatus: rs.ReleaseStatus,
+		Revision:      rs.Revision,
+		ChartVersion:  rs.ChartVersion,
+		Updated:       rs.Updated,
+		Pods:          make([]*helmapipb.Pod, 0, len(rs.Pods)),
+	}
+	if rs.SuspendedAt != nil {
+		result.SuspendedAt = timestamppb.New(*rs.SuspendedAt)
+	}
+	for _, pod := range rs.Pods {
+		result.Pods = append(result.Pods, &helmapipb.Pod{
+			Name:         pod.Name,
+			Namespace:    pod.Namespace,
+			RuntimeId:    pod.RuntimeId,
+			OwnerId:      pod.OwnerId,
+			Node:         pod.Node,
+			Status:       pod.Status,
+			Ready:        pod.Ready,
+			RestartCount: pod.RestartCount,
+			CreatedAt:    timestamppb.New(pod.CreatedAt.Time),
+		})
+	}
+	return result
+}
+
+// UpgradeRuntime moves a runtime to a new chart version and/or patches its
+// values
+func (s *Server) UpgradeRuntime(ctx context.Context, req *helmapipb.UpgradeRuntimeRequest) (*helmapipb.UpgradeRuntimeResponse, error) {
+	if err := validateRuntimeId(req.RuntimeId); err != nil {
+		return nil, err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return nil, err
+	}
+	strategy := client.MergeStrategy(req.Strategy)
+	switch strategy {
+	case "", client.ReuseValues, client.MergePatch, client.JSONPatch, client.ReplaceValues:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown merge strategy %s", req.Strategy)
+	}
+
+	upgrade := client.RuntimeUpgrade{
+		ChartVersion:      req.ChartVersion,
+		PrivateChartsRepo: req.PrivateChartsRepo,
+		Strategy:          strategy,
+		Timeout:           req.Timeout,
+		DryRun:            req.DryRun,
+	}
+	if req.Values != nil {
+		values, err := json.Marshal(req.Values.AsInterface())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		upgrade.Values = values
+	}
+
+	result, err := client.UpgradeRuntime(req.RuntimeId, upgrade)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	values, err := structpb.NewStruct(result.Values)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.UpgradeRuntimeResponse{
+		OldChartVersion: result.OldChartVersion,
+		NewChartVersion: result.NewChartVersion,
+		Values:          values,
+	}, nil
+}
+
+// RollbackRuntime rolls the release of a runtime back to a revision, or the
+// previous one
+func (s *Server) RollbackRuntime(ctx context.Context, req *helmapipb.RollbackRuntimeRequest) (*helmapipb.RollbackRuntimeResponse, error) {
+	if err := validateRuntimeId(req.RuntimeId); err != nil {
+		return nil, err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return nil, err
+	}
+	if req.Revision < 0 {
+		return nil, status.Error(codes.InvalidArgument, "revision cannot be negative")
+	}
+
+	revision := ""
+	if req.Revision > 0 {
+		revision = strconv.Itoa(int(req.Revision))
+	}
+	if err := client.RollbackRuntime(req.RuntimeId, revision, req.Timeout); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.RollbackRuntimeResponse{}, nil
+}
+
+// ListRuntimes lists runtimes as seen from their pods
+func (s *Server) ListRuntimes(ctx context.Context, req *helmapipb.ListRuntimesRequest) (*helmapipb.ListRuntimesResponse, error) {
+	selector, err := k8s.NewRuntimeSelector().Owners(req.Users...).Matching(req.Labels).String()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	list, err := client.ListRuntimes(ctx, k8s.PodQuery{
+		Namespace: req.Namespace,
+		Selector:  selector,
+		Live:      req.Live,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	result := &helmapipb.ListRuntimesResponse{Runtimes: make([]*helmapipb.RuntimeSummary, 0, len(list.Runtimes))}
+	for _, rt := range list.Runtimes {
+		result.Runtimes = append(result.Runtimes, &helmapipb.RuntimeSummary{
+			RuntimeId: rt.RuntimeId,
+			OwnerId:   rt.OwnerId,
+			Namespace: rt.Namespace,
+			Pods:      int32(rt.Pods),
+			ReadyPods: int32(rt.ReadyPods),
+		})
+	}
+	return result, nil
+}
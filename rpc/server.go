@@ -0,0 +1,159 @@
+// Package rpc serves the gRPC API of helmapi, defined in
+// helmapipb/helmapi.proto. It calls the same client layer as the HTTP API.
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+	"github.com/dush-t/helmapi/rpc/helmapipb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Server implements the HelmAPI service
+type Server struct {
+	helmapipb.UnimplementedHelmAPIServer
+}
+
+// NewServer returns a server for the HelmAPI service
+func NewServer() *Server {
+	return &Server{}
+}
+
+// Serve listens on addr and serves the gRPC API until it fails
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer()
+	helmapipb.RegisterHelmAPIServer(s, NewServer())
+	return s.Serve(lis)
+}
+
+// toStatus maps errors of the client layer to gRPC status codes
+func toStatus(err error) error {
+	switch err.(type) {
+	case *client.QuotaExceededError:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case *client.InvalidSpecError, *client.InvalidRequestError:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case *client.RuntimeExistsError:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case *client.LockBusyError:
+		return status.Error(codes.Aborted, err.Error())
+	}
+	if err == client.ErrReleaseNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// validateReleaseName applies the rules Helm has for release names
+func validateReleaseName(field string, name string) error {
+	if len(name) == 0 {
+		return status.Errorf(codes.InvalidArgument, "%s is required", field)
+	}
+	if len(name) > client.ReleaseNameMaxLength {
+		return status.Errorf(codes.InvalidArgument, "%s must be at most %d characters", field, client.ReleaseNameMaxLength)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return status.Errorf(codes.InvalidArgument, "%s: %s", field, errs[0])
+	}
+	return nil
+}
+
+// validateRuntimeId checks that rt-<id> is a valid release name
+func validateRuntimeId(runtimeId string) error {
+	if len(runtimeId) == 0 {
+		return status.Error(codes.InvalidArgument, "runtime_id is required")
+	}
+	return validateReleaseName(fmt.Sprintf("runtime_id %s", runtimeId), "rt-"+runtimeId)
+}
+
+func validateTimeout(timeout string) error {
+	if len(timeout) == 0 {
+		return nil
+	}
+	if _, err := time.ParseDuration(timeout); err != nil {
+		return status.Errorf(codes.InvalidArgument, "timeout must be a duration like 5m or 1h30m")
+	}
+	return nil
+}
+
+// InstallChart installs a chart, or upgrades its release if it exists
+func (s *Server) InstallChart(ctx context.Context, req *helmapipb.InstallChartRequest) (*helmapipb.InstallChartResponse, error) {
+	if len(req.ChartName) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chart_name is required")
+	}
+	if err := validateReleaseName("release_name", req.ReleaseName); err != nil {
+		return nil, err
+	}
+
+	ir := client.InstallRequest{
+		ChartName:         req.ChartName,
+		ReleaseName:       req.ReleaseName,
+		PrivateChartsRepo: req.PrivateChartsRepo,
+		Values:            req.Values.AsMap(),
+		Flags:             req.Flags,
+	}
+	if err := ir.Execute(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.InstallChartResponse{}, nil
+}
+
+// DeleteRelease uninstalls a release
+func (s *Server) DeleteRelease(ctx context.Context, req *helmapipb.DeleteReleaseRequest) (*helmapipb.DeleteReleaseResponse, error) {
+	if err := validateReleaseName("release_name", req.ReleaseName); err != nil {
+		return nil, err
+	}
+	if err := validateTimeout(req.Timeout); err != nil {
+		return nil, err
+	}
+
+	dr := client.DeleteRequest{ReleaseName: req.ReleaseName}
+	if err := dr.Execute(req.Timeout); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.DeleteReleaseResponse{}, nil
+}
+
+func (s *Server) AddRepo(ctx context.Context, req *helmapipb.AddRepoRequest) (*helmapipb.AddRepoResponse, error) {
+	if len(req.Name) == 0 || len(req.Url) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "name and url are required")
+	}
+
+	ra := client.RepoAddRequest{Name: req.Name, URL: req.Url}
+	if err := ra.Execute(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.AddRepoResponse{}, nil
+}
+
+func (s *Server) RemoveRepos(ctx context.Context, req *helmapipb.RemoveReposRequest) (*helmapipb.RemoveReposResponse, error) {
+	if len(req.Repos) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "repos is required")
+	}
+
+	rr := client.RepoRemoveRequest{Repos: req.Repos}
+	if err := rr.Execute(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.RemoveReposResponse{}, nil
+}
+
+// UpdateRepos fetches the latest charts of every repo
+func (s *Server) UpdateRepos(ctx context.Context, req *helmapipb.UpdateReposRequest) (*helmapipb.UpdateReposResponse, error) {
+	if err := client.UpdateRepos(); err != nil {
+		return nil, toStatus(err)
+	}
+	return &helmapipb.UpdateReposResponse{}, nil
+}
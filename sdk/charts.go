@@ -0,0 +1,42 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// Install installs a chart, or upgrades its release if it exists
+func (c *Client) Install(ctx context.Context, ir client.InstallRequest) error {
+	return c.do(ctx, http.MethodPost, "/v1/releases", nil, ir, nil)
+}
+
+// DeleteRelease uninstalls a release. timeout is passed to helm, e.g. "5m",
+// and may be empty.
+func (c *Client) DeleteRelease(ctx context.Context, releaseName string, timeout string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/releases/"+url.PathEscape(releaseName), timeoutQuery(timeout), nil, nil)
+}
+
+// AddRepo adds a chart repo
+func (c *Client) AddRepo(ctx context.Context, ra client.RepoAddRequest) error {
+	return c.do(ctx, http.MethodPost, "/v1/repos", nil, ra, nil)
+}
+
+// RemoveRepo removes a chart repo
+func (c *Client) RemoveRepo(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/repos/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// UpdateRepos fetches the latest charts of every repo
+func (c *Client) UpdateRepos(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/repos:update", nil, nil, nil)
+}
+
+func timeoutQuery(timeout string) url.Values {
+	if len(timeout) == 0 {
+		return nil
+	}
+	return url.Values{"timeout": {timeout}}
+}
@@ -0,0 +1,164 @@
+// Package sdk is a Go client for the HTTP API of helmapi. It talks to the
+// versioned routes under /v1 and shares its request and response types with
+// the server through the client package.
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// Client calls a helmapi server. Its fields can be changed before the first
+// call.
+type Client struct {
+	// BaseURL is where the server is, e.g. http://helmapi:8080
+	BaseURL string
+	// Token is sent as a bearer token, if set
+	Token string
+	// HTTPClient makes the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Retry decides how failed requests are retried
+	Retry RetryPolicy
+}
+
+// New returns a client for the server at baseURL that retries with
+// DefaultRetryPolicy
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Retry:   DefaultRetryPolicy,
+	}
+}
+
+// APIError is returned when the server answers with an error status
+type APIError struct {
+	StatusCode int
+	// Message and Details come from the body of the response, if it has one
+	Message string
+	Details []string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("helmapi: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Message) > 0 {
+		msg += ": " + e.Message
+	}
+	if len(e.Details) > 0 {
+		msg += " (" + strings.Join(e.Details, "; ") + ")"
+	}
+	return msg
+}
+
+// IsNotFound tells if err is a 404 from the server
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsQuotaExceeded tells if err is the server refusing a request over quota
+func IsQuotaExceeded(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusForbidden
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// do sends a request and decodes the response into out, unless it is nil.
+// Mutating requests carry an Idempotency-Key, so that retrying them is safe.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	idempotencyKey := ""
+	if method != http.MethodGet {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if len(c.Token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		if len(idempotencyKey) > 0 {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+
+		res, err := httpClient.Do(req)
+		if err == nil {
+			err = decodeResponse(res, out)
+			if err == nil {
+				return nil
+			}
+		}
+
+		wait, retry := c.Retry.next(attempt, res, err)
+		if !retry {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// decodeResponse reads a response, turning error statuses into an APIError
+func decodeResponse(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: res.StatusCode}
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+		var payload client.ErrorResponse
+		if json.Unmarshal(data, &payload) == nil {
+			apiErr.Message = payload.Error
+			apiErr.Details = payload.Details
+		}
+		return apiErr
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
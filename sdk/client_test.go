@@ -0,0 +1,1078 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dush-t/helmapi/api"
+	"github.com/dush-t/helmapi/client"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// The SDK is tested against the real /v1 handlers. helm is this test binary
+// run through a symlink named helm, keeping its releases and repos in
+// files, and KUBECONFIG points at fakeCluster, an in-memory API server.
+
+const fakeHelmStateEnv = "HELMAPI_FAKE_HELM_STATE"
+
+var cluster *fakeCluster
+
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "helm" {
+		os.Exit(fakeHelm(os.Args[1:]))
+	}
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "helmapi-sdk-test-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake helm
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	binDir := filepath.Join(dir, "bin")
+	stateDir := filepath.Join(dir, "helm")
+	for _, d := range []string{binDir, filepath.Join(stateDir, "releases")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := os.Symlink(self, filepath.Join(binDir, "helm")); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv(fakeHelmStateEnv, stateDir)
+
+	// Fake cluster
+	cluster = newFakeCluster()
+	server := httptest.NewServer(cluster)
+	defer func() {
+		// The pod informer keeps a watch open
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	err = ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+    namespace: default
+    user: fake
+current-context: fake
+users:
+- name: fake
+  user: {}
+`, server.URL)), 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("KUBECONFIG", kubeconfig)
+
+	return m.Run()
+}
+
+// fakeCluster serves create, get, list, watch, update and delete for any
+// resource, which covers what helmapi does with leases, pods and workloads
+type fakeCluster struct {
+	mu       sync.Mutex
+	version  int
+	objects  map[string]map[string]interface{}
+	watchers map[*fakeWatcher]bool
+}
+
+// fakeWatcher receives the changes to one kind of resource
+type fakeWatcher struct {
+	prefix    string
+	resource  string
+	namespace string
+	selector  labels.Selector
+	events    chan map[string]interface{}
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		objects:  map[string]map[string]interface{}{},
+		watchers: map[*fakeWatcher]bool{},
+	}
+}
+
+// resourcePath splits /api/v1/namespaces/ns/pods/name and
+// /apis/group/version/... into the API prefix, resource, namespace and name
+func resourcePath(path string) (prefix string, resource string, namespace string, name string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		prefix, parts = strings.Join(parts[:2], "/"), parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		prefix, parts = strings.Join(parts[:3], "/"), parts[3:]
+	default:
+		return "", "", "", "", false
+	}
+
+	if len(parts) >= 2 && parts[0] == "namespaces" {
+		namespace, parts = parts[1], parts[2:]
+	}
+	switch len(parts) {
+	case 1:
+		return prefix, parts[0], namespace, "", true
+	case 2:
+		return prefix, parts[0], namespace, parts[1], true
+	}
+	return "", "", "", "", false
+}
+
+func objectKey(prefix string, resource string, namespace string, name string) string {
+	return strings.Join([]string{prefix, resource, namespace, name}, "|")
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"reason":     reason,
+		"message":    message,
+		"code":       code,
+	})
+}
+
+func metadataOf(obj map[string]interface{}) map[string]interface{} {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		obj["metadata"] = meta
+	}
+	return meta
+}
+
+func labelsOf(obj map[string]interface{}) labels.Set {
+	set := labels.Set{}
+	if l, ok := metadataOf(obj)["labels"].(map[string]interface{}); ok {
+		for k, v := range l {
+			set[k], _ = v.(string)
+		}
+	}
+	return set
+}
+
+// matches tells if the object stored under key is of the given resource and
+// namespace, and has matching labels
+func matches(key string, obj map[string]interface{}, prefix string, resource string, namespace string, selector labels.Selector) bool {
+	parts := strings.Split(key, "|")
+	if parts[0] != prefix || parts[1] != resource || (len(namespace) > 0 && parts[2] != namespace) {
+		return false
+	}
+	return selector.Matches(labelsOf(obj))
+}
+
+// store saves or deletes an object and tells the watchers. The caller holds
+// c.mu.
+func (c *fakeCluster) store(key string, obj map[string]interface{}, eventType string) {
+	if eventType == "DELETED" {
+		delete(c.objects, key)
+	} else {
+		c.objects[key] = obj
+	}
+	for watcher := range c.watchers {
+		if matches(key, obj, watcher.prefix, watcher.resource, watcher.namespace, watcher.selector) {
+			select {
+			case watcher.events <- map[string]interface{}{"type": eventType, "object": obj}:
+			default:
+			}
+		}
+	}
+}
+
+func (c *fakeCluster) watch(w http.ResponseWriter, r *http.Request, watcher *fakeWatcher) {
+	c.mu.Lock()
+	c.watchers[watcher] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.watchers, watcher)
+		c.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-watcher.events:
+			json.NewEncoder(w).Encode(event)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix, resource, namespace, name, ok := resourcePath(r.URL.Path)
+	if !ok {
+		writeStatus(w, http.StatusNotFound, "NotFound", r.URL.Path+" not found")
+		return
+	}
+
+	if r.Method == http.MethodGet && len(name) == 0 {
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		if r.URL.Query().Get("watch") == "true" {
+			c.watch(w, r, &fakeWatcher{
+				prefix:    prefix,
+				resource:  resource,
+				namespace: namespace,
+				selector:  selector,
+				events:    make(chan map[string]interface{}, 100),
+			})
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		items := []interface{}{}
+		for key, obj := range c.objects {
+			if matches(key, obj, prefix, resource, namespace, selector) {
+				items = append(items, obj)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": strconv.Itoa(c.version)},
+			"items":    items,
+		})
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	key := objectKey(prefix, resource, namespace, name)
+	switch {
+	case r.Method == http.MethodGet:
+		obj, ok := c.objects[key]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound", name+" not found")
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+
+	case r.Method == http.MethodPost && len(name) == 0, r.Method == http.MethodPut && len(name) > 0:
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		meta := metadataOf(obj)
+		eventType := "MODIFIED"
+		if r.Method == http.MethodPost {
+			name, _ = meta["name"].(string)
+			key = objectKey(prefix, resource, namespace, name)
+			if _, exists := c.objects[key]; exists {
+				writeStatus(w, http.StatusConflict, "AlreadyExists", name+" already exists")
+				return
+			}
+			eventType = "ADDED"
+			meta["uid"] = fmt.Sprintf("uid-%d", c.version+1)
+			meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+		} else if _, exists := c.objects[key]; !exists {
+			writeStatus(w, http.StatusNotFound, "NotFound", name+" not found")
+			return
+		}
+		c.version++
+		meta["namespace"] = namespace
+		meta["resourceVersion"] = strconv.Itoa(c.version)
+		c.store(key, obj, eventType)
+
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(obj)
+
+	case r.Method == http.MethodDelete && len(name) > 0:
+		obj, ok := c.objects[key]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound", name+" not found")
+			return
+		}
+		c.store(key, obj, "DELETED")
+		json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": "Success"})
+
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+	}
+}
+
+// addPod puts a pod straight into the cluster, as the chart would
+func (c *fakeCluster) addPod(name string, podLabels map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.store(objectKey("api/v1", "pods", "default", name), map[string]interface{}{
+		"kind":       "Pod",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"name":              name,
+			"namespace":         "default",
+			"uid":               "uid-" + name,
+			"resourceVersion":   strconv.Itoa(c.version),
+			"creationTimestamp": time.Now().UTC().Format(time.RFC3339),
+			"labels":            podLabels,
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "runtime", "image": "mayanr:1"}},
+		},
+		"status": map[string]interface{}{
+			"phase":      "Running",
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+			"containerStatuses": []interface{}{map[string]interface{}{
+				"name":  "runtime",
+				"ready": true,
+				"state": map[string]interface{}{"running": map[string]interface{}{}},
+			}},
+		},
+	}, "ADDED")
+}
+
+// addSecret puts a Secret with the given data into the default namespace
+func (c *fakeCluster) addSecret(name string, data map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	encoded := map[string]interface{}{}
+	for key, val := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(val))
+	}
+	c.store(objectKey("api/v1", "secrets", "default", name), map[string]interface{}{
+		"kind":       "Secret",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "default",
+			"resourceVersion": strconv.Itoa(c.version),
+		},
+		"data": encoded,
+	}, "ADDED")
+}
+
+// secretData returns the decoded data of a Secret in the default namespace
+func (c *fakeCluster) secretData(name string) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	obj, ok := c.objects[objectKey("api/v1", "secrets", "default", name)]
+	if !ok {
+		return nil, false
+	}
+	data := map[string]string{}
+	encoded, _ := obj["data"].(map[string]interface{})
+	for key, val := range encoded {
+		decoded, _ := base64.StdEncoding.DecodeString(val.(string))
+		data[key] = string(decoded)
+	}
+	return data, true
+}
+
+// fakeRelease is what fake helm keeps of a release
+type fakeRelease struct {
+	Name     string                 `json:"name"`
+	Chart    string                 `json:"chart"`
+	Revision int                    `json:"revision"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+func helmState(parts ...string) string {
+	return filepath.Join(append([]string{os.Getenv(fakeHelmStateEnv)}, parts...)...)
+}
+
+func loadFakeRelease(name string) (*fakeRelease, error) {
+	data, err := ioutil.ReadFile(helmState("releases", name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var release fakeRelease
+	err = json.Unmarshal(data, &release)
+	return &release, err
+}
+
+func saveJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func loadRepos() map[string]string {
+	repos := map[string]string{}
+	if data, err := ioutil.ReadFile(helmState("repos.json")); err == nil {
+		json.Unmarshal(data, &repos)
+	}
+	return repos
+}
+
+// setValue sets a value given with --set, typed the way helm types it
+func setValue(values map[string]interface{}, path []string, raw string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[key] = next
+		}
+		values = next
+	}
+
+	var value interface{} = raw
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		value = float64(i)
+	} else if b, err := strconv.ParseBool(raw); err == nil {
+		value = b
+	}
+	values[path[len(path)-1]] = value
+}
+
+// fakeHelm implements the helm commands helmapi runs
+func fakeHelm(args []string) int {
+	fail := func(format string, a ...interface{}) int {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+		return 1
+	}
+	if len(args) == 0 {
+		return fail("no command")
+	}
+
+	// Split flags and their values from positional arguments
+	positional := []string{}
+	flags := map[string][]string{}
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-i", "--install", "--wait", "--all":
+			flags[arg] = append(flags[arg], "")
+		case "-f", "--set", "--repo", "--timeout", "-o", "--filter":
+			if i+1 < len(args) {
+				flags[arg] = append(flags[arg], args[i+1])
+				i++
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	switch args[0] {
+	case "repo":
+		if len(positional) == 0 {
+			return fail("repo needs a command")
+		}
+		repos := loadRepos()
+		switch positional[0] {
+		case "add":
+			repos[positional[1]] = positional[2]
+		case "remove":
+			for _, name := range positional[1:] {
+				if _, ok := repos[name]; !ok {
+					return fail("no repo named %q found", name)
+				}
+				delete(repos, name)
+			}
+		case "update":
+		}
+		if err := saveJSON(helmState("repos.json"), repos); err != nil {
+			return fail("%v", err)
+		}
+
+	case "upgrade", "rollback":
+		name := positional[0]
+		release, err := loadFakeRelease(name)
+		if err != nil {
+			if _, install := flags["-i"]; !install || args[0] == "rollback" {
+				return fail("%q has no deployed releases", name)
+			}
+			release = &fakeRelease{Name: name, Chart: positional[1] + "-1.0.0"}
+		}
+		release.Revision++
+		if args[0] == "upgrade" {
+			release.Values = map[string]interface{}{}
+			for _, file := range flags["-f"] {
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					return fail("%v", err)
+				}
+				if err := json.Unmarshal(data, &release.Values); err != nil {
+					return fail("%v", err)
+				}
+			}
+			for _, set := range flags["--set"] {
+				for _, pair := range strings.Split(set, ",") {
+					kv := strings.SplitN(pair, "=", 2)
+					if len(kv) != 2 {
+						return fail("failed parsing --set data: %s", pair)
+					}
+					setValue(release.Values, strings.Split(kv[0], "."), kv[1])
+				}
+			}
+		}
+		if err := saveJSON(helmState("releases", name+".json"), release); err != nil {
+			return fail("%v", err)
+		}
+		fmt.Println("{}")
+
+	case "uninstall":
+		if err := os.Remove(helmState("releases", positional[0]+".json")); err != nil {
+			return fail("uninstall: Release not loaded: %s: release: not found", positional[0])
+		}
+
+	case "list":
+		filter, err := regexp.Compile(strings.Join(flags["--filter"], ""))
+		if err != nil {
+			return fail("%v", err)
+		}
+		files, _ := filepath.Glob(helmState("releases", "*.json"))
+		list := []map[string]string{}
+		for _, file := range files {
+			release, err := loadFakeRelease(strings.TrimSuffix(filepath.Base(file), ".json"))
+			if err != nil || !filter.MatchString(release.Name) {
+				continue
+			}
+			list = append(list, map[string]string{
+				"name":        release.Name,
+				"namespace":   "default",
+				"revision":    strconv.Itoa(release.Revision),
+				"updated":     "2021-03-01 10:00:00.000000000 +0000 UTC",
+				"status":      "deployed",
+				"chart":       release.Chart,
+				"app_version": "1.0.0",
+			})
+		}
+		json.NewEncoder(os.Stdout).Encode(list)
+
+	case "get":
+		release, err := loadFakeRelease(positional[1])
+		if err != nil {
+			return fail("release: not found")
+		}
+		json.NewEncoder(os.Stdout).Encode(release.Values)
+
+	default:
+		return fail("unknown command %q", args[0])
+	}
+	return 0
+}
+
+// newTestClient runs the /v1 API and returns an SDK client for it
+func newTestClient(t *testing.T) *Client {
+	server := httptest.NewServer(api.V1Handler())
+	t.Cleanup(server.Close)
+
+	c := New(server.URL)
+	c.Retry = RetryPolicy{MaxAttempts: 3, MinWait: time.Millisecond, MaxWait: 10 * time.Millisecond}
+	return c
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestInstallAndDeleteRelease(t *testing.T) {
+	c := newTestClient(t)
+	ctx := testContext(t)
+
+	err := c.Install(ctx, client.InstallRequest{
+		ChartName:   "nginx",
+		ReleaseName: "web",
+		Values: map[string]interface{}{
+			"replicas": 2,
+			"image":    map[string]interface{}{"tag": "v2"},
+			"hosts":    []interface{}{"a.example.com", "b.example.com"},
+			"tls":      nil,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := loadFakeRelease("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Chart != "nginx-1.0.0" || release.Revision != 1 {
+		t.Errorf("release = %+v, want nginx at revision 1", release)
+	}
+	if release.Values["replicas"] != float64(2) {
+		t.Errorf("replicas = %v, want 2", release.Values["replicas"])
+	}
+	if tag := release.Values["image"].(map[string]interface{})["tag"]; tag != "v2" {
+		t.Errorf("image.tag = %v, want v2", tag)
+	}
+	if hosts, _ := release.Values["hosts"].([]interface{}); len(hosts) != 2 {
+		t.Errorf("hosts = %v, want both hosts", release.Values["hosts"])
+	}
+	if v, ok := release.Values["tls"]; !ok || v != nil {
+		t.Errorf("tls = %v, want null to be kept", v)
+	}
+
+	if err := c.DeleteRelease(ctx, "web", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFakeRelease("web"); !os.IsNotExist(err) {
+		t.Errorf("release still there after delete: %v", err)
+	}
+}
+
+func TestInstallKeepsSecretsOutOfValues(t *testing.T) {
+	c := newTestClient(t)
+	ctx := testContext(t)
+	cluster.addSecret("db", map[string]string{"password": "hunter2"})
+
+	err := c.Install(ctx, client.InstallRequest{
+		ChartName:   "nginx",
+		ReleaseName: "app",
+		Values: map[string]interface{}{
+			"db": map[string]interface{}{
+				"user":     "app",
+				"password": map[string]interface{}{"$secretRef": map[string]interface{}{"name": "db", "key": "password"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(helmState("releases", "app.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("release values hold the resolved secret: %s", data)
+	}
+
+	release, err := loadFakeRelease("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := release.Values["db"].(map[string]interface{})
+	want := map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "helmapi-values-app", "key": "db.password"}}
+	if !reflect.DeepEqual(db["password"], want) {
+		t.Errorf("db.password = %v, want %v", db["password"], want)
+	}
+	if db["user"] != "app" {
+		t.Errorf("db.user = %v, want app", db["user"])
+	}
+
+	secret, ok := cluster.secretData("helmapi-values-app")
+	if !ok || secret["db.password"] != "hunter2" {
+		t.Errorf("release secret = %v, want db.password resolved", secret)
+	}
+
+	if err := c.DeleteRelease(ctx, "app", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cluster.secretData("helmapi-values-app"); ok {
+		t.Error("release secret still there after delete")
+	}
+}
+
+func TestInstallRejectsInvalidRequest(t *testing.T) {
+	c := newTestClient(t)
+
+	err := c.Install(testContext(t), client.InstallRequest{ChartName: "nginx", ReleaseName: "Not_A_Release"})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want a 400", err)
+	}
+}
+
+func TestRepos(t *testing.T) {
+	c := newTestClient(t)
+	ctx := testContext(t)
+
+	if err := c.AddRepo(ctx, client.RepoAddRequest{Name: "stable", URL: "https://charts.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if url := loadRepos()["stable"]; url != "https://charts.example.com" {
+		t.Errorf("stable = %q after add", url)
+	}
+
+	if err := c.UpdateRepos(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RemoveRepo(ctx, "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadRepos()["stable"]; ok {
+		t.Error("stable still there after remove")
+	}
+
+	if err := c.RemoveRepo(ctx, "stable"); err == nil {
+		t.Error("removing a missing repo should fail")
+	}
+}
+
+func TestRuntimeLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	ctx := testContext(t)
+
+	spec := client.RuntimeSpec{
+		RuntimeId:         "abc",
+		Owner:             "alice",
+		PrivateChartsRepo: "https://charts.example.com",
+		Values:            map[string]interface{}{"image": map[string]interface{}{"tag": "v2"}},
+	}
+	status, err := c.CreateRuntime(ctx, spec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ReleaseStatus != "deployed" || status.Revision != "1" {
+		t.Errorf("status after create = %+v", status)
+	}
+
+	release, err := loadFakeRelease("rt-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	podLabels, _ := release.Values["podLabels"].(map[string]interface{})
+	if podLabels["userRuntimeOwner"] != "alice" || podLabels["mayaResourceType"] != "userRuntime" {
+		t.Errorf("podLabels = %v, want the runtime labels", podLabels)
+	}
+
+	_, err = c.CreateRuntime(ctx, spec, "")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("creating an existing runtime: err = %v, want a 409", err)
+	}
+
+	cluster.addPod("rt-abc-0", map[string]interface{}{
+		"mayaResourceType":           "userRuntime",
+		"userRuntimeOwner":           "alice",
+		"app.kubernetes.io/instance": "rt-abc",
+	})
+
+	// The pod reaches the informer cache through a watch
+	var list *client.RuntimeList
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		list, err = c.ListRuntimes(ctx, RuntimeFilter{Users: []string{"alice"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Runtimes) > 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if len(list.Runtimes) != 1 || list.Runtimes[0].RuntimeId != "abc" || list.Runtimes[0].ReadyPods != 1 {
+		t.Errorf("runtimes of alice = %+v, want abc with a ready pod", list.Runtimes)
+	}
+	list, err = c.ListRuntimes(ctx, RuntimeFilter{Users: []string{"bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Runtimes) != 0 {
+		t.Errorf("runtimes of bob = %+v, want none", list.Runtimes)
+	}
+
+	status, err = c.GetRuntime(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != client.RuntimeStateRunning || len(status.Pods) != 1 {
+		t.Errorf("status = %+v, want Running with one pod", status)
+	}
+
+	if err := c.RestartRuntime(ctx, "abc", RestartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	release, err = loadFakeRelease("rt-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Revision != 2 {
+		t.Errorf("revision after restart = %d, want 2", release.Revision)
+	}
+	if tag := release.Values["image"].(map[string]interface{})["tag"]; tag != "v2" {
+		t.Errorf("image.tag after restart = %v, want the values to be kept", tag)
+	}
+
+	if err := c.DeleteRuntime(ctx, "abc", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetRuntime(ctx, "abc"); !IsNotFound(err) {
+		t.Errorf("get after delete: err = %v, want not found", err)
+	}
+	if err := c.DeleteRuntime(ctx, "abc", ""); !IsNotFound(err) {
+		t.Errorf("delete of a missing runtime: err = %v, want not found", err)
+	}
+	if err := c.RestartRuntime(ctx, "abc", RestartOptions{}); !IsNotFound(err) {
+		t.Errorf("restart of a missing runtime: err = %v, want not found", err)
+	}
+}
+
+func TestInstallRequestWithoutChartsRepo(t *testing.T) {
+	c := newTestClient(t)
+	ctx := testContext(t)
+
+	// A release made outside of helmapi has no privateChartsRepo value
+	err := c.Install(ctx, client.InstallRequest{
+		ChartName:   "mayanr",
+		ReleaseName: "rt-bare",
+		Values:      map[string]interface{}{"replicas": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.DeleteRelease(ctx, "rt-bare", "")
+
+	if _, err := client.GetInstallRequestFromRuntimeId("bare"); err == nil {
+		t.Error("want an error for a runtime without privateChartsRepo")
+	}
+}
+
+func TestCreateRuntimeRejectsInvalidSpec(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.CreateRuntime(testContext(t), client.RuntimeSpec{RuntimeId: "abc", Owner: "alice"}, "")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want a 400", err)
+	}
+}
+
+// flakyServer answers with the given statuses, one per attempt, and 204
+// once they run out. It records the Idempotency-Key of every attempt.
+type flakyServer struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	keys     []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := len(s.keys)
+	s.keys = append(s.keys, r.Header.Get("Idempotency-Key"))
+	if attempt >= len(s.statuses) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	status := s.statuses[attempt]
+	if status == 0 {
+		// Drop the connection, like a network failure
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return
+	}
+	for key, values := range s.header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(client.ErrorResponse{Error: http.StatusText(status)})
+}
+
+func (s *flakyServer) attempts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.keys...)
+}
+
+func newFlakyClient(t *testing.T, s *flakyServer, policy RetryPolicy) *Client {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL)
+	c.Retry = policy
+	return c
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 4, MinWait: time.Millisecond, MaxWait: 10 * time.Millisecond}
+
+func TestRetryTransientFailures(t *testing.T) {
+	for _, status := range []int{0, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			s := &flakyServer{statuses: []int{status, status}}
+			c := newFlakyClient(t, s, fastRetry)
+
+			if err := c.UpdateRepos(testContext(t)); err != nil {
+				t.Fatalf("err = %v, want success after retrying", err)
+			}
+
+			keys := s.attempts()
+			if len(keys) != 3 {
+				t.Fatalf("%d attempts, want 3", len(keys))
+			}
+			if len(keys[0]) == 0 || keys[1] != keys[0] || keys[2] != keys[0] {
+				t.Errorf("idempotency keys = %q, want the same key on every attempt", keys)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyPerCall(t *testing.T) {
+	s := &flakyServer{}
+	c := newFlakyClient(t, s, fastRetry)
+	ctx := testContext(t)
+
+	if err := c.UpdateRepos(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateRepos(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestartRuntime(ctx, "abc", RestartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := s.attempts()
+	if keys[0] == keys[1] || keys[1] == keys[2] {
+		t.Errorf("idempotency keys = %q, want a new key for every call", keys)
+	}
+}
+
+func TestGetHasNoIdempotencyKey(t *testing.T) {
+	s := &flakyServer{statuses: []int{http.StatusServiceUnavailable}}
+	c := newFlakyClient(t, s, fastRetry)
+
+	if _, err := c.GetRuntime(testContext(t), "abc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range s.attempts() {
+		if len(key) > 0 {
+			t.Errorf("GET sent Idempotency-Key %s", key)
+		}
+	}
+}
+
+func TestNoRetryOnClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusInternalServerError} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			s := &flakyServer{statuses: []int{status}}
+			c := newFlakyClient(t, s, fastRetry)
+
+			err := c.DeleteRuntime(testContext(t), "abc", "")
+			apiErr, ok := err.(*APIError)
+			if !ok || apiErr.StatusCode != status {
+				t.Fatalf("err = %v, want a %d", err, status)
+			}
+			if n := len(s.attempts()); n != 1 {
+				t.Errorf("%d attempts, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	s := &flakyServer{statuses: []int{503, 503, 503, 503, 503, 503}}
+	c := newFlakyClient(t, s, fastRetry)
+
+	err := c.UpdateRepos(testContext(t))
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want the last 503", err)
+	}
+	if n := len(s.attempts()); n != fastRetry.MaxAttempts {
+		t.Errorf("%d attempts, want %d", n, fastRetry.MaxAttempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	// Without Retry-After the client would wait a minute
+	s := &flakyServer{statuses: []int{http.StatusTooManyRequests}, header: http.Header{"Retry-After": {"0"}}}
+	c := newFlakyClient(t, s, RetryPolicy{MaxAttempts: 2, MinWait: time.Minute, MaxWait: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.UpdateRepos(ctx); err != nil {
+		t.Fatalf("err = %v, want success right after Retry-After", err)
+	}
+}
+
+func TestRetryConflictInProgress(t *testing.T) {
+	// The server adds Retry-After to a 409 while an earlier attempt with
+	// the same Idempotency-Key is running
+	s := &flakyServer{statuses: []int{http.StatusConflict}, header: http.Header{"Retry-After": {"0"}}}
+	c := newFlakyClient(t, s, fastRetry)
+
+	if err := c.UpdateRepos(testContext(t)); err != nil {
+		t.Fatalf("err = %v, want success after retrying", err)
+	}
+	if n := len(s.attempts()); n != 2 {
+		t.Errorf("%d attempts, want 2", n)
+	}
+}
+
+func TestNext(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MinWait: 100 * time.Millisecond, MaxWait: time.Second}
+	response := func(status int, retryAfter string) (*http.Response, error) {
+		res := &http.Response{StatusCode: status, Header: http.Header{}}
+		if len(retryAfter) > 0 {
+			res.Header.Set("Retry-After", retryAfter)
+		}
+		return res, &APIError{StatusCode: status}
+	}
+
+	res, err := response(http.StatusServiceUnavailable, "7")
+	if wait, retry := policy.next(0, res, err); !retry || wait != 7*time.Second {
+		t.Errorf("Retry-After 7: next = %v, %v, want 7s, true", wait, retry)
+	}
+
+	res, err = response(http.StatusServiceUnavailable, "")
+	if wait, retry := policy.next(1, res, err); !retry || wait < 100*time.Millisecond || wait > 200*time.Millisecond {
+		t.Errorf("second retry: next = %v, %v, want 100ms to 200ms", wait, retry)
+	}
+
+	if _, retry := policy.next(2, res, err); retry {
+		t.Error("retried past MaxAttempts")
+	}
+
+	res, err = response(http.StatusNotFound, "1")
+	if _, retry := policy.next(0, res, err); retry {
+		t.Error("retried a 404")
+	}
+
+	if _, retry := policy.next(0, nil, context.Canceled); retry {
+		t.Error("retried a canceled request")
+	}
+
+	// A 200 whose body could not be decoded is not retried, as the
+	// request went through
+	if _, retry := policy.next(0, &http.Response{StatusCode: http.StatusOK}, fmt.Errorf("bad json")); retry {
+		t.Error("retried a response that went through")
+	}
+}
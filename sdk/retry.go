@@ -0,0 +1,71 @@
+package sdk
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries requests that failed for reasons that may go away:
+// network errors, 429, 502, 503, 504, and 409 with a Retry-After header,
+// which the server answers while an earlier attempt with the same
+// Idempotency-Key is still running. Other conflicts, like a runtime that
+// already exists, are final. Waits grow exponentially from MinWait to
+// MaxWait, with jitter, and follow the Retry-After header when there is one.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 1 disables retries
+	MaxAttempts int
+	MinWait     time.Duration
+	MaxWait     time.Duration
+}
+
+// DefaultRetryPolicy makes up to 4 attempts over about 5 seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinWait:     500 * time.Millisecond,
+	MaxWait:     5 * time.Second,
+}
+
+var retryableStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// next tells if a failed attempt (counted from 0) should be retried, and
+// how long to wait before doing so
+func (p RetryPolicy) next(attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if attempt+1 >= p.MaxAttempts {
+		return 0, false
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return 0, false
+	}
+
+	if apiErr, ok := err.(*APIError); ok {
+		retryAfter := res.Header.Get("Retry-After")
+		inProgress := apiErr.StatusCode == http.StatusConflict && len(retryAfter) > 0
+		if !retryableStatuses[apiErr.StatusCode] && !inProgress {
+			return 0, false
+		}
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	} else if res != nil {
+		// The response came through but its body could not be decoded
+		return 0, false
+	}
+
+	wait := p.MinWait << uint(attempt)
+	if wait <= 0 || wait > p.MaxWait {
+		wait = p.MaxWait
+	}
+	// Full jitter keeps clients that failed together from retrying together
+	if wait > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+	return wait, true
+}
@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dush-t/helmapi/client"
+)
+
+// RuntimeFilter narrows down ListRuntimes. Empty fields match everything.
+type RuntimeFilter struct {
+	Users     []string
+	Labels    map[string]string
+	Namespace string
+	// CreatedAfter keeps runtimes with pods created at or after it
+	CreatedAfter *time.Time
+	// Live asks the API server instead of the cache of the server
+	Live bool
+}
+
+func (f RuntimeFilter) query() url.Values {
+	query := url.Values{}
+	if len(f.Users) > 0 {
+		query.Set("users", strings.Join(f.Users, ","))
+	}
+	for key, value := range f.Labels {
+		query.Add("label", key+"="+value)
+	}
+	if len(f.Namespace) > 0 {
+		query.Set("namespace", f.Namespace)
+	}
+	if f.CreatedAfter != nil {
+		query.Set("createdAfter", f.CreatedAfter.Format(time.RFC3339))
+	}
+	if f.Live {
+		query.Set("live", "true")
+	}
+	return query
+}
+
+// RestartOptions tune RestartRuntime. Empty fields use the defaults of the
+// server.
+type RestartOptions struct {
+	Strategy client.RestartStrategy
+	// Timeout is how long to wait for the runtime, e.g. "5m"
+	Timeout string
+}
+
+// CreateRuntime installs a runtime and returns its status
+func (c *Client) CreateRuntime(ctx context.Context, rs client.RuntimeSpec, timeout string) (*client.RuntimeStatus, error) {
+	var status client.RuntimeStatus
+	if err := c.do(ctx, http.MethodPost, "/v1/runtimes", timeoutQuery(timeout), rs, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListRuntimes lists runtimes as seen from their pods
+func (c *Client) ListRuntimes(ctx context.Context, filter RuntimeFilter) (*client.RuntimeList, error) {
+	var list client.RuntimeList
+	if err := c.do(ctx, http.MethodGet, "/v1/runtimes", filter.query(), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetRuntime returns the release and pod state of a runtime. Use IsNotFound
+// to tell a missing runtime from other errors.
+func (c *Client) GetRuntime(ctx context.Context, runtimeId string) (*client.RuntimeStatus, error) {
+	var status client.RuntimeStatus
+	if err := c.do(ctx, http.MethodGet, "/v1/runtimes/"+url.PathEscape(runtimeId), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RestartRuntime restarts a runtime and waits for it to come back
+func (c *Client) RestartRuntime(ctx context.Context, runtimeId string, opts RestartOptions) error {
+	query := timeoutQuery(opts.Timeout)
+	if len(opts.Strategy) > 0 {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("strategy", string(opts.Strategy))
+	}
+	return c.do(ctx, http.MethodPost, "/v1/runtimes/"+url.PathEscape(runtimeId)+":restart", query, nil, nil)
+}
+
+// DeleteRuntime uninstalls a runtime. timeout is passed to helm and may be
+// empty.
+func (c *Client) DeleteRuntime(ctx context.Context, runtimeId string, timeout string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/runtimes/"+url.PathEscape(runtimeId), timeoutQuery(timeout), nil, nil)
+}